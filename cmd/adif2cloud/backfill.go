@@ -0,0 +1,316 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+
+	"git.esd.cc/imlonghao/adif2cloud/pkg/adif"
+	"git.esd.cc/imlonghao/adif2cloud/pkg/filter"
+	"git.esd.cc/imlonghao/adif2cloud/pkg/provider"
+
+	"github.com/spf13/viper"
+)
+
+// backfillBatchSize 是每次交给提供商的记录数，每批完成后保存进度。
+// 支持批量上传的提供商会再按自身的限制拆分请求
+const backfillBatchSize = 500
+
+// backfillFilter 选择需要回填的 QSO
+type backfillFilter struct {
+	from, to string // YYYYMMDD，为空表示不限
+	calls    []string
+	bands    []string
+}
+
+func (f backfillFilter) match(fields map[string]string) bool {
+	date := fields["qso_date"]
+	if f.from != "" && date < f.from {
+		return false
+	}
+	if f.to != "" && date > f.to {
+		return false
+	}
+	if len(f.calls) > 0 && !slices.Contains(f.calls, strings.ToUpper(fields["call"])) {
+		return false
+	}
+	if len(f.bands) > 0 && !slices.Contains(f.bands, strings.ToLower(fields["band"])) {
+		return false
+	}
+	return true
+}
+
+// parseDate 接受 2006-01-02 或 20060102 格式的日期，返回 ADIF 的 YYYYMMDD 格式
+func parseDate(s string) (string, error) {
+	if s == "" {
+		return "", nil
+	}
+	for _, layout := range []string{"2006-01-02", "20060102"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.Format("20060102"), nil
+		}
+	}
+	return "", fmt.Errorf("invalid date %q, expected YYYY-MM-DD", s)
+}
+
+// runBackfill 把源文件中已有的 QSO 上传到指定的目标
+func runBackfill(args []string) {
+	flags := flag.NewFlagSet("backfill", flag.ExitOnError)
+	configPath := flags.String("config", "config.yaml", "Path to configuration file")
+	targetsFlag := flags.String("targets", "", "Comma separated target names to send to (required)")
+	sourceFlag := flags.String("source", "", "ADIF file to read (defaults to source in config when it is a single file)")
+	fromFlag := flags.String("from", "", "Only QSOs on or after this date (YYYY-MM-DD)")
+	toFlag := flags.String("to", "", "Only QSOs on or before this date (YYYY-MM-DD)")
+	callFlag := flags.String("call", "", "Only QSOs with these comma separated callsigns")
+	bandFlag := flags.String("band", "", "Only QSOs on these comma separated bands, e.g. 20m,40m")
+	dryRun := flags.Bool("dry-run", false, "List the QSOs that would be sent without sending them")
+	restart := flags.Bool("restart", false, "Ignore progress saved by previous runs and send everything again")
+	flags.Parse(args)
+
+	names := splitList(*targetsFlag)
+	if len(names) == 0 {
+		fmt.Fprintln(os.Stderr, "backfill: -targets is required")
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	var filter backfillFilter
+	var err error
+	if filter.from, err = parseDate(*fromFlag); err != nil {
+		slog.Error("Invalid -from", "error", err)
+		os.Exit(2)
+	}
+	if filter.to, err = parseDate(*toFlag); err != nil {
+		slog.Error("Invalid -to", "error", err)
+		os.Exit(2)
+	}
+	for _, call := range splitList(*callFlag) {
+		filter.calls = append(filter.calls, strings.ToUpper(call))
+	}
+	for _, band := range splitList(*bandFlag) {
+		filter.bands = append(filter.bands, strings.ToLower(band))
+	}
+
+	loadConfig(*configPath)
+	sourceFile := *sourceFlag
+	if sourceFile == "" {
+		files := sourceFiles()
+		if len(files) != 1 {
+			slog.Error("Source in config is not a single file, choose one with -source", "files", len(files))
+			os.Exit(2)
+		}
+		sourceFile = files[0]
+	}
+	data, err := os.ReadFile(sourceFile)
+	if err != nil {
+		slog.Error("Failed to read source file", "error", err)
+		os.Exit(1)
+	}
+
+	var records []string
+	for _, record := range adif.SplitAny(string(data)) {
+		if filter.match(adif.Parse(record)) {
+			records = append(records, record)
+		}
+	}
+	slog.Info("Selected QSOs for backfill", "source", sourceFile, "count", len(records))
+
+	if *dryRun {
+		dryRunBackfill(names, records, *restart)
+		return
+	}
+
+	targets := buildTargets(names)
+	if len(targets) != len(names) {
+		slog.Error("Not all targets could be created")
+		os.Exit(1)
+	}
+
+	// Ctrl+C aborts the upload in flight, progress up to that point is kept
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	deliveries := openLedger()
+	defer deliveries.Close()
+
+	failed := 0
+	for _, t := range targets {
+		if ctx.Err() != nil {
+			break
+		}
+		logger := slog.With("target", t.name)
+		progress, err := openBackfillProgress(viper.GetString("state_dir"), t.name, *restart)
+		if err != nil {
+			logger.Error("Failed to open backfill progress", "error", err)
+			os.Exit(1)
+		}
+
+		todo := backfillTodo(logger, t.filter, records, progress.done)
+		logger.Info("Starting backfill", "pending", len(todo), "already_sent", len(records)-len(todo))
+
+		batches := provider.Batches(todo, backfillBatchSize, 0)
+		if provider.UploadsFile(t.provider) && len(todo) > 0 {
+			// 一次上传整个源文件就包含了所有记录
+			batches = [][]string{todo}
+		}
+		sent, targetFailed := 0, 0
+		for _, batch := range batches {
+			if ctx.Err() != nil {
+				break
+			}
+			errs := provider.UploadBatch(ctx, t.provider, sourceFile, batch)
+			for i, record := range batch {
+				identity := adif.Identity(adif.Parse(record))
+				if errs[i] != nil && ctx.Err() != nil {
+					// 被中止的上传不记入账本
+					targetFailed++
+					continue
+				}
+				if err := deliveries.Result(t.name, identity, record, errs[i]); err != nil {
+					logger.Warn("Failed to write delivery ledger", "error", err)
+				}
+				if errs[i] != nil {
+					targetFailed++
+					logger.Error("Failed to upload QSO", "identity", identity, "error", errs[i])
+					continue
+				}
+				sent++
+				if err := progress.markDone(identity); err != nil {
+					logger.Warn("Failed to save backfill progress", "error", err)
+				}
+			}
+			logger.Info("Uploaded QSOs", "progress", fmt.Sprintf("%d/%d", sent+targetFailed, len(todo)), "sent", sent, "failed", targetFailed)
+		}
+		progress.Close()
+		failed += targetFailed
+		logger.Info("Finished backfill", "sent", sent, "failed", targetFailed)
+	}
+
+	if ctx.Err() != nil {
+		slog.Error("Backfill interrupted, run it again to continue")
+		os.Exit(1)
+	}
+	if failed > 0 {
+		slog.Error("Backfill finished with failures, run it again to retry them", "failed", failed)
+		os.Exit(1)
+	}
+}
+
+// dryRunBackfill 列出每个目标会回填的 QSO。只读取配置和进度，
+// 不创建提供商（例如克隆 Git 仓库）、不写账本，也不清空进度
+func dryRunBackfill(names, records []string, restart bool) {
+	configs := loadTargetConfigs()
+	wanted := wantedTargets(configs, names)
+	for _, cfg := range configs {
+		if !wanted[cfg.Name] {
+			continue
+		}
+		logger := slog.With("target", cfg.Name)
+		done := make(map[string]bool)
+		if !restart {
+			var err error
+			if done, err = readBackfillProgress(backfillProgressPath(viper.GetString("state_dir"), cfg.Name)); err != nil {
+				logger.Error("Failed to read backfill progress", "error", err)
+				os.Exit(1)
+			}
+		}
+		todo := backfillTodo(logger, cfg.filter, records, done)
+		logger.Info("Starting backfill", "pending", len(todo), "already_sent", len(records)-len(todo), "dry_run", true)
+		for _, record := range todo {
+			logger.Info("Would send QSO", "identity", adif.Identity(adif.Parse(record)))
+		}
+	}
+}
+
+// backfillTodo 返回目标过滤规则接收、并且还没有回填过的记录
+func backfillTodo(logger *slog.Logger, f *filter.Filter, records []string, done map[string]bool) []string {
+	var todo []string
+	for _, record := range records {
+		fields := adif.Parse(record)
+		identity := adif.Identity(fields)
+		if ok, reason := f.Match(fields); !ok {
+			logger.Debug("Skipping QSO filtered out for target", "identity", identity, "reason", reason)
+			continue
+		}
+		if !done[identity] {
+			todo = append(todo, record)
+		}
+	}
+	return todo
+}
+
+// backfillProgress 记录已经成功回填到某个目标的 QSO 身份，中断后再次运行时跳过它们
+type backfillProgress struct {
+	done map[string]bool
+	file *os.File
+}
+
+func backfillProgressPath(stateDir, name string) string {
+	return filepath.Join(stateDir, "backfill", name+".txt")
+}
+
+func openBackfillProgress(stateDir, name string, restart bool) (*backfillProgress, error) {
+	path := backfillProgressPath(stateDir, name)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	flags := os.O_RDWR | os.O_CREATE | os.O_APPEND
+	if restart {
+		flags |= os.O_TRUNC
+	}
+	f, err := os.OpenFile(path, flags, 0644)
+	if err != nil {
+		return nil, err
+	}
+	done, err := scanBackfillProgress(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &backfillProgress{done: done, file: f}, nil
+}
+
+// readBackfillProgress 只读取进度，文件不存在时返回空
+func readBackfillProgress(path string) (map[string]bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return make(map[string]bool), nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+	return scanBackfillProgress(f)
+}
+
+func scanBackfillProgress(r io.Reader) (map[string]bool, error) {
+	done := make(map[string]bool)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			done[line] = true
+		}
+	}
+	return done, scanner.Err()
+}
+
+func (p *backfillProgress) markDone(identity string) error {
+	p.done[identity] = true
+	_, err := fmt.Fprintln(p.file, identity)
+	return err
+}
+
+func (p *backfillProgress) Close() {
+	p.file.Close()
+}
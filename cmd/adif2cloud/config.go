@@ -0,0 +1,271 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"git.esd.cc/imlonghao/adif2cloud/pkg/filter"
+	"git.esd.cc/imlonghao/adif2cloud/pkg/ledger"
+	"git.esd.cc/imlonghao/adif2cloud/pkg/outbox"
+	"git.esd.cc/imlonghao/adif2cloud/pkg/provider"
+	"git.esd.cc/imlonghao/adif2cloud/pkg/transform"
+	"git.esd.cc/imlonghao/adif2cloud/pkg/watcher"
+
+	"github.com/spf13/viper"
+)
+
+// defaultTargetTimeout 是目标未配置 timeout 时单次操作的超时时间
+const defaultTargetTimeout = time.Minute
+
+// targetConfig 是所有目标共有的配置，其余字段交给对应类型的提供商解析
+type targetConfig struct {
+	Name      string                 `mapstructure:"name"`
+	Type      string                 `mapstructure:"type" required:"true"`
+	Timeout   time.Duration          `mapstructure:"timeout"`
+	Filter    filter.Config          `mapstructure:"filter"`
+	When      string                 `mapstructure:"when"`
+	Transform []transform.Step       `mapstructure:"transform"`
+	Options   map[string]interface{} `mapstructure:",remain"`
+
+	// filter 和 pipeline 是加载配置时编译的过滤规则和转换步骤
+	filter   *filter.Filter
+	pipeline *transform.Pipeline
+}
+
+// sourceConfig 是一个源文件或 glob，Targets 为空时发送到所有目标
+type sourceConfig struct {
+	Path    string   `mapstructure:"path" required:"true"`
+	Targets []string `mapstructure:"targets"`
+}
+
+// target 是一个已创建的目标，name 用于在命令行中引用它，filter 为 nil 时接收所有 QSO
+type target struct {
+	name     string
+	provider provider.Provider
+	filter   *filter.Filter
+}
+
+// loadConfig 读取配置文件，出错时直接退出
+func loadConfig(path string) {
+	viper.SetDefault("state_dir", "state")
+	viper.SetDefault("startup_policy", string(policyPrompt))
+	viper.SetDefault("shutdown_grace", "30s")
+	viper.SetConfigFile(path)
+	if err := viper.ReadInConfig(); err != nil {
+		slog.Error("Cannot read configuration file", "error", err)
+		os.Exit(1)
+	}
+}
+
+// loadTargetConfigs 解析配置中的目标但不创建提供商，
+// 未指定 name 的目标使用类型名，同类型的第二个起依次为 type-2、type-3……
+func loadTargetConfigs() []targetConfig {
+	var raws []map[string]interface{}
+	if err := viper.UnmarshalKey("target", &raws); err != nil {
+		slog.Error("Failed to parse target configuration", "error", err)
+		os.Exit(1)
+	}
+
+	configs := make([]targetConfig, len(raws))
+	seen := make(map[string]bool)
+	typeCount := make(map[string]int)
+	for i, raw := range raws {
+		if err := provider.Decode(raw, &configs[i]); err != nil {
+			slog.Error("Invalid target configuration", "index", i, "error", err)
+			os.Exit(1)
+		}
+		cfg := &configs[i]
+		typeCount[cfg.Type]++
+		if cfg.Name == "" {
+			cfg.Name = cfg.Type
+			if n := typeCount[cfg.Type]; n > 1 {
+				cfg.Name = fmt.Sprintf("%s-%d", cfg.Type, n)
+			}
+		}
+		if seen[cfg.Name] {
+			slog.Error("Duplicate target name", "index", i, "name", cfg.Name)
+			os.Exit(1)
+		}
+		seen[cfg.Name] = true
+		cfg.Filter.When = cfg.When
+		var err error
+		if cfg.filter, err = filter.Compile(cfg.Filter); err != nil {
+			slog.Error("Invalid target filter", "index", i, "name", cfg.Name, "error", err)
+			os.Exit(1)
+		}
+		if cfg.pipeline, err = transform.Compile(cfg.Transform); err != nil {
+			slog.Error("Invalid target transform", "index", i, "name", cfg.Name, "error", err)
+			os.Exit(1)
+		}
+	}
+	return configs
+}
+
+// wantedTargets 返回 names 中列出的目标名称集合，名称不在 configs 中时直接退出
+func wantedTargets(configs []targetConfig, names []string) map[string]bool {
+	seen := make(map[string]bool, len(configs))
+	for _, cfg := range configs {
+		seen[cfg.Name] = true
+	}
+
+	wanted := make(map[string]bool)
+	for _, name := range names {
+		if !seen[name] {
+			slog.Error("Unknown target name", "name", name, "available", strings.Join(targetNames(configs), ", "))
+			os.Exit(1)
+		}
+		wanted[name] = true
+	}
+	return wanted
+}
+
+// buildTargets 创建配置中的目标，names 不为空时只创建其中列出的目标
+func buildTargets(names []string) []target {
+	configs := loadTargetConfigs()
+	wanted := wantedTargets(configs, names)
+
+	var targets []target
+	for i, cfg := range configs {
+		if len(wanted) > 0 && !wanted[cfg.Name] {
+			continue
+		}
+		p, err := provider.New(cfg.Type, cfg.Options)
+		if err != nil {
+			var cfgErr *provider.ConfigError
+			if errors.As(err, &cfgErr) {
+				slog.Error("Invalid target configuration", "index", i, "name", cfg.Name, "type", cfg.Type, "error", err)
+				os.Exit(1)
+			}
+			slog.Error("Failed to create provider", "index", i, "name", cfg.Name, "type", cfg.Type, "error", err)
+			continue
+		}
+		timeout := cfg.Timeout
+		if timeout == 0 {
+			timeout = defaultTargetTimeout
+		}
+		targets = append(targets, target{name: cfg.Name, provider: provider.WithTimeout(transform.Wrap(p, cfg.pipeline), timeout), filter: cfg.filter})
+		slog.Info("Created provider", "name", cfg.Name, "type", cfg.Type, "provider", p.GetName(), "timeout", timeout)
+	}
+	return targets
+}
+
+// loadSourceConfigs 解析配置中的源文件。source 可以是一个路径或 glob，
+// 也可以是一个列表，列表中的每一项是路径，或带 path 和 targets 的对象
+func loadSourceConfigs() []sourceConfig {
+	var items []interface{}
+	switch raw := viper.Get("source").(type) {
+	case nil:
+		return nil
+	case string:
+		if raw == "" {
+			return nil
+		}
+		items = []interface{}{raw}
+	case []interface{}:
+		items = raw
+	default:
+		slog.Error("Invalid source configuration, expected a path or a list")
+		os.Exit(1)
+	}
+
+	configs := make([]sourceConfig, len(items))
+	for i, item := range items {
+		switch item := item.(type) {
+		case string:
+			configs[i].Path = item
+		case map[string]interface{}:
+			if err := provider.Decode(item, &configs[i]); err != nil {
+				slog.Error("Invalid source configuration", "index", i, "error", err)
+				os.Exit(1)
+			}
+		default:
+			slog.Error("Invalid source configuration, expected a path or an object with path and targets", "index", i)
+			os.Exit(1)
+		}
+		if configs[i].Path == "" {
+			slog.Error("Invalid source configuration, path is empty", "index", i)
+			os.Exit(1)
+		}
+		checkTargetNames(configs[i].Targets)
+	}
+	return configs
+}
+
+// listenerTargets 读取 key（例如 wsjtx.targets）中的目标名称，为空时发送到所有目标
+func listenerTargets(key string) []string {
+	return checkTargetNames(viper.GetStringSlice(key))
+}
+
+// sourceFiles 返回配置中的源文件当前匹配的所有文件，没有通配符的路径即使不存在也会返回
+func sourceFiles() []string {
+	sources := loadSourceConfigs()
+	patterns := make([]string, len(sources))
+	for i, src := range sources {
+		patterns[i] = src.Path
+	}
+	matches, err := watcher.Glob(patterns)
+	if err != nil {
+		slog.Error("Invalid source configuration", "error", err)
+		os.Exit(1)
+	}
+	var files []string
+	for i, src := range sources {
+		if len(matches[i]) == 0 && !hasGlobMeta(src.Path) {
+			files = append(files, src.Path)
+		}
+		files = append(files, matches[i]...)
+	}
+	return files
+}
+
+// hasGlobMeta 判断路径中是否包含 glob 通配符
+func hasGlobMeta(path string) bool {
+	return strings.ContainsAny(path, "*?[")
+}
+
+func targetNames(configs []targetConfig) []string {
+	names := make([]string, len(configs))
+	for i, cfg := range configs {
+		names[i] = cfg.Name
+	}
+	return names
+}
+
+func outboxTargets(targets []target) []outbox.Target {
+	out := make([]outbox.Target, len(targets))
+	for i, t := range targets {
+		out[i] = outbox.Target{Name: t.name, Provider: t.provider, Filter: t.filter}
+	}
+	return out
+}
+
+// ledgerPath 返回投递账本的位置
+func ledgerPath() string {
+	return filepath.Join(viper.GetString("state_dir"), "ledger.jsonl")
+}
+
+// openLedger 打开投递账本，出错时直接退出
+func openLedger() *ledger.Ledger {
+	l, err := ledger.Open(ledgerPath())
+	if err != nil {
+		slog.Error("Failed to open delivery ledger", "error", err)
+		os.Exit(1)
+	}
+	return l
+}
+
+// splitList 解析逗号分隔的命令行参数
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+	"text/tabwriter"
+
+	"git.esd.cc/imlonghao/adif2cloud/pkg/adif"
+	"git.esd.cc/imlonghao/adif2cloud/pkg/provider"
+)
+
+// pushFailure 是一条没有送达某个目标的记录，index 从 1 开始
+type pushFailure struct {
+	index    int
+	identity string
+	target   string
+	err      error
+}
+
+// runPush 把标准输入或文件中的 ADIF 记录上传到配置的目标，有记录失败时以非零状态退出
+func runPush(args []string) {
+	flags := flag.NewFlagSet("push", flag.ExitOnError)
+	configPath := flags.String("config", "config.yaml", "Path to configuration file")
+	targetsFlag := flags.String("targets", "", "Comma separated target names to send to (defaults to all)")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: adif2cloud push [flags] [file]\n\nReads ADI or ADX from file, or from standard input when file is omitted or -.")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() > 1 {
+		fmt.Fprintln(os.Stderr, "push: at most one file can be given")
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	input, name := os.Stdin, "standard input"
+	if path := flags.Arg(0); path != "" && path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			slog.Error("Failed to open input file", "error", err)
+			os.Exit(1)
+		}
+		defer f.Close()
+		input, name = f, path
+	}
+	data, err := io.ReadAll(input)
+	if err != nil {
+		slog.Error("Failed to read input", "input", name, "error", err)
+		os.Exit(1)
+	}
+	records := adif.SplitAny(string(data))
+	if len(records) == 0 {
+		slog.Error("No QSO records in input", "input", name)
+		os.Exit(1)
+	}
+	slog.Info("Read QSOs to push", "input", name, "count", len(records))
+
+	loadConfig(*configPath)
+	names := splitList(*targetsFlag)
+	wanted := len(names)
+	if wanted == 0 {
+		wanted = len(loadTargetConfigs())
+	}
+	targets := buildTargets(names)
+	if len(targets) != wanted {
+		slog.Error("Not all targets could be created")
+		os.Exit(1)
+	}
+
+	// Ctrl+C aborts the upload in flight, records not sent are listed as failed
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	deliveries := openLedger()
+	defer deliveries.Close()
+
+	var failures []pushFailure
+	used := 0
+	for _, t := range targets {
+		logger := slog.With("target", t.name)
+		// 输入不是源文件，上传整个文件的目标会用它覆盖远程副本
+		if provider.UploadsFile(t.provider) {
+			logger.Warn("Skipping target that uploads the whole log file")
+			continue
+		}
+		used++
+
+		var indexes []int
+		var todo []string
+		for i, record := range records {
+			fields := adif.Parse(record)
+			if ok, reason := t.filter.Match(fields); !ok {
+				logger.Debug("Skipping QSO filtered out for target", "identity", adif.Identity(fields), "reason", reason)
+				continue
+			}
+			indexes = append(indexes, i)
+			todo = append(todo, record)
+		}
+
+		sent, failed := 0, 0
+		offset := 0
+		for _, batch := range provider.Batches(todo, backfillBatchSize, 0) {
+			errs := provider.UploadBatch(ctx, t.provider, "", batch)
+			for i, record := range batch {
+				identity := adif.Identity(adif.Parse(record))
+				if errs[i] == nil || ctx.Err() == nil {
+					// 被中止的上传不记入账本
+					if err := deliveries.Result(t.name, identity, record, errs[i]); err != nil {
+						logger.Warn("Failed to write delivery ledger", "error", err)
+					}
+				}
+				if errs[i] != nil {
+					failed++
+					failures = append(failures, pushFailure{index: indexes[offset+i] + 1, identity: identity, target: t.name, err: errs[i]})
+					logger.Error("Failed to upload QSO", "identity", identity, "error", errs[i])
+					continue
+				}
+				sent++
+			}
+			offset += len(batch)
+		}
+		logger.Info("Finished push", "sent", sent, "failed", failed, "filtered", len(records)-len(todo))
+	}
+
+	if used == 0 {
+		slog.Error("No target can receive pushed QSOs")
+		os.Exit(1)
+	}
+	if len(failures) > 0 {
+		tw := tabwriter.NewWriter(os.Stderr, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "RECORD\tQSO\tTARGET\tERROR")
+		for _, f := range failures {
+			fmt.Fprintf(tw, "%d\t%s\t%s\t%v\n", f.index, f.identity, f.target, f.err)
+		}
+		tw.Flush()
+		fmt.Fprintf(os.Stderr, "\n%d failed delivery(ies)\n", len(failures))
+		os.Exit(1)
+	}
+}
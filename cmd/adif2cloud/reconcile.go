@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+
+	"git.esd.cc/imlonghao/adif2cloud/pkg/adif"
+	"git.esd.cc/imlonghao/adif2cloud/pkg/outbox"
+	"git.esd.cc/imlonghao/adif2cloud/pkg/reconcile"
+	"git.esd.cc/imlonghao/adif2cloud/pkg/watcher"
+)
+
+// startupPolicy 决定启动时本地与远程记录不一致时如何处理
+type startupPolicy string
+
+const (
+	// policyPrompt 在终端中询问，没有终端时等同于 policyNever
+	policyPrompt startupPolicy = "prompt"
+	// policyNever 只记录差异，不修改任何内容
+	policyNever startupPolicy = "never"
+	// policyAutoMerge 合并仅存在于远程的记录，并补传仅存在于本地的记录
+	policyAutoMerge startupPolicy = "auto-merge"
+	// policyAutoReplace 备份本地文件后用远程副本替换
+	policyAutoReplace startupPolicy = "auto-replace-with-backup"
+)
+
+func parseStartupPolicy(s string) (startupPolicy, error) {
+	switch p := startupPolicy(strings.ToLower(strings.TrimSpace(s))); p {
+	case policyPrompt, policyNever, policyAutoMerge, policyAutoReplace:
+		return p, nil
+	case "":
+		return policyPrompt, nil
+	default:
+		return "", fmt.Errorf("unknown startup policy %q, must be one of: %s, %s, %s, %s",
+			s, policyPrompt, policyNever, policyAutoMerge, policyAutoReplace)
+	}
+}
+
+// isTerminal 判断标准输入是否为终端
+func isTerminal() bool {
+	fi, err := os.Stdin.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// reconcileSource 按 QSO 身份比较本地文件与每个可下载的远程副本，
+// 根据 policy 决定是否合并、替换本地文件，以及是否把仅存在于本地的记录补传到该远程
+func reconcileSource(ctx context.Context, sourceFile, statePath string, targets []target, dispatcher *outbox.Dispatcher, policy startupPolicy) {
+	if policy == policyPrompt && !isTerminal() {
+		slog.Warn("Standard input is not a terminal, will not prompt", "policy", policy, "fallback", policyNever)
+		policy = policyNever
+	}
+	stdin := bufio.NewReader(os.Stdin)
+
+	for _, t := range targets {
+		p := t.provider
+		logger := slog.With("provider", p.GetName(), "policy", policy)
+
+		var remote bytes.Buffer
+		if err := p.Download(ctx, &remote); err != nil {
+			logger.Debug("Skipping reconcile, remote copy not available", "error", err)
+			continue
+		}
+		local, err := os.ReadFile(sourceFile)
+		if err != nil {
+			slog.Error("Failed to read local file", "error", err)
+			os.Exit(1)
+		}
+
+		result := reconcile.Compare(string(local), remote.String())
+		logger.Info("Compared local and remote records",
+			"common", result.Common,
+			"local_only", len(result.LocalOnly),
+			"remote_only", len(result.RemoteOnly))
+		for _, record := range result.RemoteOnly {
+			logger.Info("QSO only exists on remote", "identity", adif.Identity(adif.Parse(record)))
+		}
+		for _, record := range result.LocalOnly {
+			logger.Info("QSO only exists locally", "identity", adif.Identity(adif.Parse(record)))
+		}
+
+		if len(result.RemoteOnly) > 0 {
+			switch {
+			case policy == policyAutoReplace:
+				logger.Info("Startup decision", "decision", "replace")
+				replaceLocal(logger, sourceFile, statePath, string(local), remote.String())
+				continue
+			case policy == policyAutoMerge,
+				policy == policyPrompt && confirm(stdin, "Should we merge the remote-only QSOs into the local file? [y/N]"):
+				logger.Info("Startup decision", "decision", "merge")
+				mergeLocal(logger, sourceFile, statePath, string(local), result.RemoteOnly)
+			default:
+				logger.Info("Startup decision", "decision", "skip-merge")
+			}
+		}
+
+		if len(result.LocalOnly) > 0 {
+			switch {
+			case policy == policyAutoMerge,
+				policy == policyPrompt && confirm(stdin, "Should we upload the local-only QSOs to this provider? [y/N]"):
+				logger.Info("Startup decision", "decision", "upload-local-only")
+				queued, err := dispatcher.SubmitBatch(t.name, sourceFile, result.LocalOnly)
+				if err != nil {
+					logger.Error("Failed to enqueue local-only QSOs", "error", err)
+					break
+				}
+				logger.Info("Queued local-only QSOs for upload", "count", queued)
+			default:
+				logger.Info("Startup decision", "decision", "skip-upload")
+			}
+		}
+	}
+}
+
+// mergeLocal 备份本地文件后，在末尾追加仅存在于远程的记录
+func mergeLocal(logger *slog.Logger, sourceFile, statePath, local string, remoteOnly []string) {
+	backupPath, err := reconcile.Backup(sourceFile)
+	if err != nil {
+		logger.Error("Failed to back up local file", "error", err)
+		os.Exit(1)
+	}
+	merged, err := reconcile.Merge(local, remoteOnly)
+	if err != nil {
+		logger.Error("Failed to merge remote-only QSOs", "error", err, "backup", backupPath)
+		os.Exit(1)
+	}
+	if err := os.WriteFile(sourceFile, []byte(merged), 0644); err != nil {
+		logger.Error("Failed to write merged file", "error", err, "backup", backupPath)
+		os.Exit(1)
+	}
+	// 合并进来的记录已经存在于远程，不需要再次上传
+	if err := watcher.Remember(statePath, remoteOnly); err != nil {
+		logger.Warn("Failed to update watcher checkpoint", "error", err)
+	}
+	logger.Info("Merged remote-only QSOs into local file", "count", len(remoteOnly), "backup", backupPath)
+}
+
+// replaceLocal 备份本地文件后用远程副本替换，远程副本会转换为本地文件的格式
+func replaceLocal(logger *slog.Logger, sourceFile, statePath, local, remote string) {
+	content, err := adif.Convert([]byte(remote), adif.FormatOf(local))
+	if err != nil {
+		logger.Error("Failed to convert remote copy", "error", err)
+		os.Exit(1)
+	}
+	backupPath, err := reconcile.Backup(sourceFile)
+	if err != nil {
+		logger.Error("Failed to back up local file", "error", err)
+		os.Exit(1)
+	}
+	if err := os.WriteFile(sourceFile, content, 0644); err != nil {
+		logger.Error("Failed to write local file", "error", err, "backup", backupPath)
+		os.Exit(1)
+	}
+	if err := watcher.Remember(statePath, adif.SplitAny(remote)); err != nil {
+		logger.Warn("Failed to update watcher checkpoint", "error", err)
+	}
+	logger.Info("Replaced local file with remote copy", "backup", backupPath)
+}
+
+func confirm(stdin *bufio.Reader, question string) bool {
+	slog.Info(question)
+	answer, _ := stdin.ReadString('\n')
+	answer = strings.TrimSpace(strings.ToLower(answer))
+	return answer == "y" || answer == "yes"
+}
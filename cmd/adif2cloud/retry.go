@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log/slog"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"syscall"
+	"time"
+
+	"git.esd.cc/imlonghao/adif2cloud/pkg/ledger"
+	"git.esd.cc/imlonghao/adif2cloud/pkg/outbox"
+	"git.esd.cc/imlonghao/adif2cloud/pkg/provider"
+
+	"github.com/spf13/viper"
+)
+
+// runRetry 重新发送账本中从未成功送达的 QSO
+func runRetry(args []string) {
+	flags := flag.NewFlagSet("retry", flag.ExitOnError)
+	configPath := flags.String("config", "config.yaml", "Path to configuration file")
+	targetsFlag := flags.String("targets", "", "Comma separated target names to retry (defaults to all)")
+	targetFlag := flags.String("target", "", "Target name to retry, can be combined with -targets")
+	sinceFlag := flags.String("since", "", "Only QSOs first seen on or after this date (YYYY-MM-DD)")
+	dryRun := flags.Bool("dry-run", false, "List the QSOs that would be sent without sending them")
+	flags.Parse(args)
+
+	loadConfig(*configPath)
+	var since time.Time
+	if *sinceFlag != "" {
+		var err error
+		if since, err = parseSince(*sinceFlag); err != nil {
+			slog.Error("Invalid -since", "error", err)
+			os.Exit(2)
+		}
+	}
+	names := checkTargetNames(append(splitList(*targetsFlag), splitList(*targetFlag)...))
+
+	entries, err := ledger.Read(ledgerPath())
+	if err != nil {
+		slog.Error("Failed to read delivery ledger", "error", err)
+		os.Exit(1)
+	}
+
+	// 每个目标还没有送达的 QSO，按首次出现的顺序
+	pending := make(map[string][]*ledger.QSO)
+	for _, q := range ledger.Summarize(entries) {
+		if q.FirstSeen.Before(since) {
+			continue
+		}
+		for _, name := range q.Missing() {
+			if len(names) > 0 && !slices.Contains(names, name) {
+				continue
+			}
+			if q.Record == "" {
+				slog.Warn("Cannot retry QSO, record content is not in the ledger", "target", name, "identity", q.Identity)
+				continue
+			}
+			pending[name] = append(pending[name], q)
+		}
+	}
+	if len(pending) == 0 {
+		slog.Info("No failed deliveries to retry")
+		return
+	}
+
+	wanted := make([]string, 0, len(pending))
+	for name := range pending {
+		wanted = append(wanted, name)
+	}
+	slices.Sort(wanted)
+	if *dryRun {
+		for _, name := range wanted {
+			for _, q := range pending[name] {
+				slog.Info("Would send QSO", "target", name, "identity", q.Identity)
+			}
+		}
+		return
+	}
+
+	// 守护进程持有队列数据库的锁，同时运行会与它的重试重复上传
+	queue, err := outbox.Open(filepath.Join(viper.GetString("state_dir"), "outbox.db"))
+	if err != nil {
+		slog.Error("Failed to open upload queue, stop the running adif2cloud before retrying", "error", err)
+		os.Exit(1)
+	}
+	defer queue.Close()
+	deliveries := openLedger()
+	defer deliveries.Close()
+
+	targets := buildTargets(wanted)
+	if len(targets) != len(wanted) {
+		slog.Error("Not all targets could be created")
+		os.Exit(1)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	// 只有一个源文件时才能确定上传整个文件的目标应该上传哪个文件
+	var sourceFile string
+	if files := sourceFiles(); len(files) == 1 {
+		sourceFile = files[0]
+	}
+	failed := 0
+	for _, t := range targets {
+		logger := slog.With("target", t.name)
+		qsos := pending[t.name]
+		records := make([]string, len(qsos))
+		for i, q := range qsos {
+			records[i] = q.Record
+		}
+		if sourceFile == "" && provider.UploadsFile(t.provider) {
+			logger.Warn("Skipping target that uploads the whole log file, source in config is not a single file", "pending", len(records))
+			continue
+		}
+		logger.Info("Retrying failed deliveries", "count", len(records))
+
+		sent := 0
+		errs := provider.UploadBatch(ctx, t.provider, sourceFile, records)
+		for i, q := range qsos {
+			if errs[i] != nil {
+				failed++
+				if ctx.Err() == nil {
+					if err := deliveries.Result(t.name, q.Identity, q.Record, errs[i]); err != nil {
+						logger.Warn("Failed to write delivery ledger", "error", err)
+					}
+				}
+				logger.Error("Failed to upload QSO", "identity", q.Identity, "error", errs[i])
+				continue
+			}
+			sent++
+			if err := deliveries.Result(t.name, q.Identity, q.Record, nil); err != nil {
+				logger.Warn("Failed to write delivery ledger", "error", err)
+			}
+			// 已经送达，不再让守护进程从队列中重复上传
+			if _, err := queue.Remove(t.name, q.Record); err != nil {
+				logger.Warn("Failed to remove delivered QSO from upload queue", "identity", q.Identity, "error", err)
+			}
+		}
+		logger.Info("Finished retry", "sent", sent, "failed", len(qsos)-sent)
+	}
+
+	if failed > 0 {
+		slog.Error("Retry finished with failures, run it again later", "failed", failed)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,306 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log/slog"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"syscall"
+
+	"git.esd.cc/imlonghao/adif2cloud/pkg/ingest"
+	"git.esd.cc/imlonghao/adif2cloud/pkg/n1mm"
+	"git.esd.cc/imlonghao/adif2cloud/pkg/outbox"
+	"git.esd.cc/imlonghao/adif2cloud/pkg/provider"
+	"git.esd.cc/imlonghao/adif2cloud/pkg/source"
+	"git.esd.cc/imlonghao/adif2cloud/pkg/watcher"
+	"git.esd.cc/imlonghao/adif2cloud/pkg/wsjtx"
+
+	"github.com/spf13/viper"
+)
+
+// runDaemon 监视源文件、WSJT-X、N1MM 和 HTTP 等来源，并把新的 QSO 上传到所有目标
+func runDaemon(args []string) {
+	flags := flag.NewFlagSet("run", flag.ExitOnError)
+	configPath := flags.String("config", "config.yaml", "Path to configuration file")
+	startupPolicyFlag := flags.String("startup-policy", "", "How to handle differences with remote copies on startup: prompt, never, auto-merge or auto-replace-with-backup (overrides startup_policy in config)")
+	flags.Parse(args)
+
+	// Load configuration
+	loadConfig(*configPath)
+
+	// Cancelled on SIGINT/SIGTERM, aborting startup downloads still in flight
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	// Create providers
+	targets := buildTargets(nil)
+
+	// Get source configuration, source files are optional when QSOs come from WSJT-X, N1MM or HTTP
+	sources := loadSourceConfigs()
+	var wsjtxConfig wsjtx.Config
+	if err := viper.UnmarshalKey("wsjtx", &wsjtxConfig); err != nil {
+		slog.Error("Invalid WSJT-X configuration", "error", err)
+		os.Exit(1)
+	}
+	var n1mmConfig n1mm.Config
+	if err := viper.UnmarshalKey("n1mm", &n1mmConfig); err != nil {
+		slog.Error("Invalid N1MM configuration", "error", err)
+		os.Exit(1)
+	}
+	var httpConfig ingest.Config
+	if err := viper.UnmarshalKey("http", &httpConfig); err != nil {
+		slog.Error("Invalid HTTP configuration", "error", err)
+		os.Exit(1)
+	}
+	if len(sources) == 0 && wsjtxConfig.Listen == "" && n1mmConfig.Listen == "" && httpConfig.Listen == "" {
+		slog.Error("No source in configuration, set source, wsjtx.listen, n1mm.listen or http.listen")
+		os.Exit(1)
+	}
+
+	patterns := make([]string, len(sources))
+	for i, src := range sources {
+		patterns[i] = src.Path
+		// A plain path must exist, a glob may match files created later
+		if hasGlobMeta(src.Path) {
+			continue
+		}
+		if _, err := os.Stat(src.Path); err != nil {
+			slog.Error("Failed to get local file info", "error", err)
+			os.Exit(1)
+		}
+	}
+	files, err := watcher.Glob(patterns)
+	if err != nil {
+		slog.Error("Invalid source configuration", "error", err)
+		os.Exit(1)
+	}
+	checkWholeFileRouting(sources, targets)
+
+	// Open the persistent upload queue
+	stateDir := viper.GetString("state_dir")
+	queue, err := outbox.Open(filepath.Join(stateDir, "outbox.db"))
+	if err != nil {
+		slog.Error("Failed to open upload queue", "error", err)
+		os.Exit(1)
+	}
+
+	// Workers start after the startup comparison, which may queue local-only QSOs
+	deliveries := openLedger()
+	dispatcher := outbox.NewDispatcher(context.Background(), queue, outboxTargets(targets), deliveries)
+
+	// Compare the local file with remote copies record by record
+	policyValue := viper.GetString("startup_policy")
+	if *startupPolicyFlag != "" {
+		policyValue = *startupPolicyFlag
+	}
+	policy, err := parseStartupPolicy(policyValue)
+	if err != nil {
+		slog.Error("Invalid startup policy", "error", err)
+		os.Exit(1)
+	}
+	// Remote copies hold the whole log, they can only be compared when there is a single source file
+	var matched []string
+	var matchedSource sourceConfig
+	for i, f := range files {
+		if len(f) > 0 {
+			matchedSource = sources[i]
+		}
+		matched = append(matched, f...)
+	}
+	switch {
+	case len(matched) == 1:
+		sourceFile := matched[0]
+		reconcileSource(ctx, sourceFile, watcher.CheckpointPath(stateDir, sourceFile), routeTargets(targets, matchedSource.Targets), dispatcher, policy)
+	case len(matched) > 1:
+		slog.Info("Several source files, skipping comparison with remote copies", "files", len(matched))
+	}
+
+	dispatcher.Start()
+
+	// Create one watcher per source file, new files matching a glob are picked up while running
+	var group *watcher.Group
+	if len(sources) > 0 {
+		group, err = watcher.NewGroup(stateDir, patterns, func(pattern int, filename string, event source.Event) {
+			submitEvents(dispatcher, sources[pattern].Targets, filename)(event)
+		})
+		if err != nil {
+			slog.Error("Failed to create ADI file watcher", "error", err)
+			os.Exit(1)
+		}
+
+		// Start the watchers
+		if err := group.Start(); err != nil {
+			slog.Error("Failed to start ADI file watcher", "error", err)
+			os.Exit(1)
+		}
+		slog.Info("Started monitoring ADI files", "patterns", len(patterns), "files", group.Files())
+	}
+
+	// Listen for QSOs logged in WSJT-X, they are not part of any file
+	var wsjtxListener *wsjtx.Listener
+	if wsjtxConfig.Listen != "" {
+		wsjtxTargets := listenerTargets("wsjtx.targets")
+		checkListenerRouting("wsjtx", wsjtxTargets, targets)
+		wsjtxListener, err = wsjtx.NewListener(wsjtxConfig, submitEvents(dispatcher, wsjtxTargets, ""))
+		if err != nil {
+			slog.Error("Failed to create WSJT-X listener", "error", err)
+			os.Exit(1)
+		}
+		if err := wsjtxListener.Start(); err != nil {
+			slog.Error("Failed to start WSJT-X listener", "error", err)
+			os.Exit(1)
+		}
+	}
+
+	// Listen for contacts broadcast by N1MM Logger+
+	var n1mmListener *n1mm.Listener
+	if n1mmConfig.Listen != "" {
+		n1mmTargets := listenerTargets("n1mm.targets")
+		checkListenerRouting("n1mm", n1mmTargets, targets)
+		n1mmListener, err = n1mm.NewListener(n1mmConfig, submitEvents(dispatcher, n1mmTargets, ""))
+		if err != nil {
+			slog.Error("Failed to create N1MM listener", "error", err)
+			os.Exit(1)
+		}
+		if err := n1mmListener.Start(); err != nil {
+			slog.Error("Failed to start N1MM listener", "error", err)
+			os.Exit(1)
+		}
+	}
+
+	// Accept QSOs posted by other loggers and scripts
+	var httpServer *ingest.Server
+	if httpConfig.Listen != "" {
+		httpTargets := listenerTargets("http.targets")
+		checkListenerRouting("http", httpTargets, targets)
+		httpServer, err = ingest.NewServer(httpConfig, func(event source.Event) ingest.Routing {
+			submission := dispatcher.SubmitTo(httpTargets, "", event.Record)
+			routing := ingest.Routing{Queued: submission.Queued, Filtered: submission.Skipped}
+			for name, err := range submission.Failed {
+				if routing.Failed == nil {
+					routing.Failed = make(map[string]string)
+				}
+				routing.Failed[name] = err.Error()
+			}
+			return routing
+		})
+		if err != nil {
+			slog.Error("Failed to create HTTP ingestion server", "error", err)
+			os.Exit(1)
+		}
+		if err := httpServer.Start(); err != nil {
+			slog.Error("Failed to start HTTP ingestion server", "error", err)
+			os.Exit(1)
+		}
+	}
+
+	// Wait for interrupt signal
+	<-ctx.Done()
+	stop()
+
+	// Graceful shutdown: stop detecting new QSOs first, then give running uploads time to finish
+	grace := viper.GetDuration("shutdown_grace")
+	slog.Info("Shutting down...", "grace", grace)
+	if group != nil {
+		group.Close()
+	}
+	if wsjtxListener != nil {
+		wsjtxListener.Close()
+	}
+	if n1mmListener != nil {
+		n1mmListener.Close()
+	}
+	if httpServer != nil {
+		httpServer.Close()
+	}
+	for _, result := range dispatcher.Shutdown(grace) {
+		logger := slog.With("target", result.Target, "flushed", result.Flushed, "pending", result.Pending)
+		switch {
+		case result.Interrupted:
+			logger.Warn("Upload abandoned after grace period, pending QSOs will be sent on next start")
+		case result.Pending != 0:
+			logger.Warn("Left QSOs in the upload queue, they will be sent on next start")
+		default:
+			logger.Info("All QSOs delivered")
+		}
+	}
+	queue.Close()
+	deliveries.Close()
+	slog.Info("Safely exited")
+}
+
+// submitEvents 返回把来源事件交给 dispatcher 的回调，targets 为空时交给所有目标，
+// filename 是记录所在的源文件，不是来自文件时为空
+func submitEvents(dispatcher *outbox.Dispatcher, targets []string, filename string) func(source.Event) {
+	return func(event source.Event) {
+		switch event.Kind {
+		case source.Added:
+			slog.Info("Found new QSO record", "file_path", filename, "adi", event.Record)
+			// Queue for the routed providers, the dispatcher uploads in the background
+			if err := dispatcher.SubmitTo(targets, filename, event.Record).Err(); err != nil {
+				slog.Error("QSO record was not queued for every target", "identity", event.Identity, "error", err)
+			}
+		case source.Updated:
+			slog.Warn("QSO record was edited in the log, providers are not updated", "identity", event.Identity, "adi", event.Record)
+		case source.Deleted:
+			slog.Warn("QSO record was deleted from the log, providers are not updated", "identity", event.Identity)
+		}
+	}
+}
+
+// checkWholeFileRouting 检查每个上传整个源文件的目标最多只接收一个源文件，否则直接退出。
+// 这些目标总是写入同一个远程文件，多个源文件会互相覆盖
+func checkWholeFileRouting(sources []sourceConfig, targets []target) {
+	for _, t := range targets {
+		if !provider.UploadsFile(t.provider) {
+			continue
+		}
+		var routed []string
+		for _, src := range sources {
+			if len(src.Targets) == 0 || slices.Contains(src.Targets, t.name) {
+				routed = append(routed, src.Path)
+			}
+		}
+		switch {
+		case len(routed) > 1:
+			slog.Error("Target uploads the whole log file but receives several sources, route only one source to it with targets", "target", t.name, "sources", routed)
+			os.Exit(1)
+		case len(routed) == 1 && hasGlobMeta(routed[0]):
+			slog.Error("Target uploads the whole log file but receives a glob that can match several files, route a single file to it with targets", "target", t.name, "source", routed[0])
+			os.Exit(1)
+		}
+	}
+}
+
+// checkListenerRouting 检查来源不是文件的监听器（WSJT-X、N1MM、HTTP）的路由。
+// 上传整个源文件的目标收不到这些 QSO：明确列在 targets 中时直接退出，
+// targets 为空（交给所有目标）时只给出警告
+func checkListenerRouting(listener string, names []string, targets []target) {
+	for _, t := range routeTargets(targets, names) {
+		if !provider.UploadsFile(t.provider) {
+			continue
+		}
+		if len(names) > 0 {
+			slog.Error("Target uploads the whole log file and cannot receive QSOs from a listener, remove it from targets", "listener", listener, "target", t.name)
+			os.Exit(1)
+		}
+		slog.Warn("Target uploads the whole log file and does not receive QSOs from this listener", "listener", listener, "target", t.name)
+	}
+}
+
+// routeTargets 返回 names 中列出的目标，names 为空时返回所有目标
+func routeTargets(targets []target, names []string) []target {
+	if len(names) == 0 {
+		return targets
+	}
+	var routed []target
+	for _, t := range targets {
+		if slices.Contains(names, t.name) {
+			routed = append(routed, t)
+		}
+	}
+	return routed
+}
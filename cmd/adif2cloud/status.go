@@ -0,0 +1,130 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"git.esd.cc/imlonghao/adif2cloud/pkg/ledger"
+)
+
+// statusDefaultWindow 是 status 未指定 -since 时查看的时间范围
+const statusDefaultWindow = 7 * 24 * time.Hour
+
+// runStatus 列出最近的 QSO 中还没有送达的目标
+func runStatus(args []string) {
+	flags := flag.NewFlagSet("status", flag.ExitOnError)
+	configPath := flags.String("config", "config.yaml", "Path to configuration file")
+	sinceFlag := flags.String("since", "", "Only QSOs first seen on or after this date (YYYY-MM-DD, defaults to the last 7 days)")
+	targetsFlag := flags.String("targets", "", "Comma separated target names to check (defaults to all)")
+	flags.Parse(args)
+
+	loadConfig(*configPath)
+	since := time.Now().Add(-statusDefaultWindow)
+	if *sinceFlag != "" {
+		var err error
+		if since, err = parseSince(*sinceFlag); err != nil {
+			slog.Error("Invalid -since", "error", err)
+			os.Exit(2)
+		}
+	}
+	targets := checkTargetNames(splitList(*targetsFlag))
+
+	entries, err := ledger.Read(ledgerPath())
+	if err != nil {
+		slog.Error("Failed to read delivery ledger", "error", err)
+		os.Exit(1)
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "QSO\tTARGET\tATTEMPTS\tLAST TRY\tLAST ERROR")
+	recent, missing := 0, 0
+	for _, q := range ledger.Summarize(entries) {
+		if q.FirstSeen.Before(since) {
+			continue
+		}
+		recent++
+		for _, name := range q.Missing() {
+			if len(targets) > 0 && !slices.Contains(targets, name) {
+				continue
+			}
+			missing++
+			state := q.Targets[name]
+			lastTry := "never"
+			if !state.LastTry.IsZero() {
+				lastTry = state.LastTry.Local().Format(time.DateTime)
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%d\t%s\t%s\n", q.Identity, name, state.Attempts, lastTry, state.LastError)
+		}
+	}
+	tw.Flush()
+	fmt.Printf("\n%d QSO(s) since %s, %d missing delivery(ies)\n", recent, since.Local().Format(time.DateOnly), missing)
+}
+
+// runHistory 显示某个呼号所有 QSO 的投递记录
+func runHistory(args []string) {
+	flags := flag.NewFlagSet("history", flag.ExitOnError)
+	configPath := flags.String("config", "config.yaml", "Path to configuration file")
+	callFlag := flags.String("call", "", "Callsign to show the delivery history for (required)")
+	flags.Parse(args)
+
+	call := strings.ToUpper(strings.TrimSpace(*callFlag))
+	if call == "" {
+		fmt.Fprintln(os.Stderr, "history: -call is required")
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	loadConfig(*configPath)
+	entries, err := ledger.Read(ledgerPath())
+	if err != nil {
+		slog.Error("Failed to read delivery ledger", "error", err)
+		os.Exit(1)
+	}
+
+	found := 0
+	for _, q := range ledger.Summarize(entries) {
+		// QSO 身份以呼号开头，见 adif.Identity
+		if qsoCall, _, _ := strings.Cut(q.Identity, "|"); qsoCall != call {
+			continue
+		}
+		found++
+		fmt.Printf("%s\n", q.Identity)
+		tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		for _, e := range q.Entries {
+			fmt.Fprintf(tw, "  %s\t%s\t%s\t%s\n", e.Time.Local().Format(time.DateTime), e.Target, e.Outcome, e.Error)
+		}
+		tw.Flush()
+		fmt.Println()
+	}
+	if found == 0 {
+		fmt.Printf("No deliveries recorded for %s\n", call)
+	}
+}
+
+// parseSince 把 -since 参数解析为当天零点的本地时间
+func parseSince(s string) (time.Time, error) {
+	date, err := parseDate(s)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.ParseInLocation("20060102", date, time.Local)
+}
+
+// checkTargetNames 确认 names 都是配置中的目标，出错时直接退出
+func checkTargetNames(names []string) []string {
+	configs := loadTargetConfigs()
+	known := targetNames(configs)
+	for _, name := range names {
+		if !slices.Contains(known, name) {
+			slog.Error("Unknown target name", "name", name, "available", strings.Join(known, ", "))
+			os.Exit(1)
+		}
+	}
+	return names
+}
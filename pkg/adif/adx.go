@@ -0,0 +1,283 @@
+package adif
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+)
+
+// Log 是一个完整的日志文件，Records 是 ADI 格式的记录，
+// UserDefs 是文件头中声明的用户自定义字段名（小写）
+type Log struct {
+	UserDefs []string
+	Records  []string
+}
+
+// IsADX 判断内容是否为 ADX（XML 格式的 ADIF）
+func IsADX(data string) bool {
+	data = strings.TrimLeft(data, "\ufeff \t\r\n")
+	if strings.HasPrefix(data, "<?xml") {
+		return true
+	}
+	return len(data) >= 5 && strings.EqualFold(data[:5], "<adx>")
+}
+
+// ReadLog 读取 ADI 或 ADX 格式的日志，根据内容自动判断格式
+func ReadLog(data string) (*Log, error) {
+	if IsADX(data) {
+		return ParseADX(data)
+	}
+	return &Log{UserDefs: headerUserDefs(data), Records: Split(data)}, nil
+}
+
+// SplitAny 把 ADI 或 ADX 格式的日志切分为 ADI 格式的记录，ADX 解析出错时返回出错前的记录
+func SplitAny(data string) []string {
+	log, err := ReadLog(data)
+	if log == nil && err != nil {
+		return nil
+	}
+	return log.Records
+}
+
+// headerUserDefs 返回 ADI 文件头中 <USERDEFn> 声明的字段名
+func headerUserDefs(data string) []string {
+	eoh := strings.Index(strings.ToLower(data), "<eoh>")
+	if eoh < 0 {
+		return nil
+	}
+	var names []string
+	for _, f := range ParseFields(data[:eoh]) {
+		if strings.HasPrefix(f.Name, "userdef") {
+			// 值可以带枚举或范围，例如 SWEATERSIZE,{S,M,L}
+			name, _, _ := strings.Cut(f.Value, ",")
+			names = append(names, strings.ToLower(strings.TrimSpace(name)))
+		}
+	}
+	return names
+}
+
+// adxField 是 ADX 中的一个字段元素
+type adxField struct {
+	XMLName xml.Name
+	Attrs   []xml.Attr `xml:",any,attr"`
+	Value   string     `xml:",chardata"`
+}
+
+func (f *adxField) attr(name string) string {
+	for _, a := range f.Attrs {
+		if strings.EqualFold(a.Name.Local, name) {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+// ParseADX 解析 ADX 内容。<APP PROGRAMID="X" FIELDNAME="Y"> 转换为 app_x_y 字段，
+// <USERDEF FIELDNAME="Y"> 转换为 y 字段
+func ParseADX(data string) (*Log, error) {
+	log := &Log{}
+	d := xml.NewDecoder(strings.NewReader(data))
+	var section string
+	for {
+		tok, err := d.Token()
+		if errors.Is(err, io.EOF) {
+			return log, nil
+		}
+		if err != nil {
+			return log, fmt.Errorf("invalid ADX: %w", err)
+		}
+		start, ok := tok.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		switch name := strings.ToUpper(start.Name.Local); {
+		case name == "ADX":
+		case name == "HEADER" || name == "RECORDS":
+			section = name
+		case section == "HEADER":
+			var f adxField
+			if err := d.DecodeElement(&f, &start); err != nil {
+				return log, fmt.Errorf("invalid ADX header: %w", err)
+			}
+			if name == "USERDEF" {
+				log.UserDefs = append(log.UserDefs, strings.ToLower(strings.TrimSpace(f.Value)))
+			}
+		case section == "RECORDS" && name == "RECORD":
+			fields, err := parseADXRecord(d, start)
+			if err != nil {
+				return log, err
+			}
+			record, err := FormatRecord(fields)
+			if err != nil {
+				return log, fmt.Errorf("invalid ADX record: %w", err)
+			}
+			log.Records = append(log.Records, record)
+		default:
+			if err := d.Skip(); err != nil {
+				return log, fmt.Errorf("invalid ADX: %w", err)
+			}
+		}
+	}
+}
+
+func parseADXRecord(d *xml.Decoder, start xml.StartElement) (map[string]string, error) {
+	var record struct {
+		Fields []adxField `xml:",any"`
+	}
+	if err := d.DecodeElement(&record, &start); err != nil {
+		return nil, fmt.Errorf("invalid ADX record: %w", err)
+	}
+	fields := make(map[string]string, len(record.Fields))
+	for _, f := range record.Fields {
+		name := strings.ToLower(f.XMLName.Local)
+		switch name {
+		case "app":
+			programID, fieldName := f.attr("PROGRAMID"), f.attr("FIELDNAME")
+			if programID == "" || fieldName == "" {
+				return nil, errors.New("invalid ADX record: APP element without PROGRAMID or FIELDNAME")
+			}
+			name = strings.ToLower("app_" + programID + "_" + fieldName)
+		case "userdef":
+			if name = strings.ToLower(f.attr("FIELDNAME")); name == "" {
+				return nil, errors.New("invalid ADX record: USERDEF element without FIELDNAME")
+			}
+		}
+		fields[name] = f.Value
+	}
+	return fields, nil
+}
+
+// WriteADI 以 ADI 格式写出日志，UserDefs 在文件头中声明
+func (l *Log) WriteADI(w io.Writer, h Header) error {
+	h.UserDefs = l.UserDefs
+	writer := NewWriter(w)
+	if err := writer.WriteHeader(h); err != nil {
+		return err
+	}
+	for _, record := range l.Records {
+		if err := writer.WriteRecord(Parse(record)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteADX 以 ADX 格式写出日志。app_ 开头的字段写为 APP 元素，
+// UserDefs 中的字段写为 USERDEF 元素并在文件头中声明
+func (l *Log) WriteADX(w io.Writer, h Header) error {
+	h = h.withDefaults()
+	var b bytes.Buffer
+	b.WriteString(xml.Header)
+	b.WriteString("<ADX>\n<HEADER>\n")
+	writeADXElement(&b, "ADIF_VER", Version)
+	writeADXElement(&b, "PROGRAMID", h.ProgramID)
+	if h.ProgramVersion != "" {
+		writeADXElement(&b, "PROGRAMVERSION", h.ProgramVersion)
+	}
+	writeADXElement(&b, "CREATED_TIMESTAMP", h.Created.UTC().Format("20060102 150405"))
+	for i, name := range l.UserDefs {
+		fmt.Fprintf(&b, "<USERDEF FIELDID=\"%d\">", i+1)
+		xml.EscapeText(&b, []byte(strings.ToUpper(name)))
+		b.WriteString("</USERDEF>\n")
+	}
+	b.WriteString("</HEADER>\n<RECORDS>\n")
+	for _, record := range l.Records {
+		fields := Parse(record)
+		b.WriteString("<RECORD>\n")
+		for _, name := range FieldOrder(fields) {
+			if err := writeADXField(&b, name, fields[name], l.UserDefs); err != nil {
+				return err
+			}
+		}
+		b.WriteString("</RECORD>\n")
+	}
+	b.WriteString("</RECORDS>\n</ADX>\n")
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+func writeADXField(b *bytes.Buffer, name, value string, userDefs []string) error {
+	switch {
+	case slices.Contains(userDefs, name):
+		b.WriteString(`<USERDEF FIELDNAME="`)
+		xml.EscapeText(b, []byte(strings.ToUpper(name)))
+		b.WriteString(`">`)
+		xml.EscapeText(b, []byte(value))
+		b.WriteString("</USERDEF>\n")
+	case strings.HasPrefix(name, "app_"):
+		programID, fieldName, ok := strings.Cut(strings.TrimPrefix(name, "app_"), "_")
+		if !ok || programID == "" || fieldName == "" {
+			return fmt.Errorf("invalid application-defined field name %q", name)
+		}
+		b.WriteString(`<APP PROGRAMID="`)
+		xml.EscapeText(b, []byte(strings.ToUpper(programID)))
+		b.WriteString(`" FIELDNAME="`)
+		xml.EscapeText(b, []byte(strings.ToUpper(fieldName)))
+		b.WriteString(`" TYPE="S">`)
+		xml.EscapeText(b, []byte(value))
+		b.WriteString("</APP>\n")
+	default:
+		if !validName(name) {
+			return fmt.Errorf("invalid ADIF field name %q", name)
+		}
+		writeADXElement(b, strings.ToUpper(name), value)
+	}
+	return nil
+}
+
+func writeADXElement(b *bytes.Buffer, name, value string) {
+	fmt.Fprintf(b, "<%s>", name)
+	xml.EscapeText(b, []byte(value))
+	fmt.Fprintf(b, "</%s>\n", name)
+}
+
+// 日志文件格式
+const (
+	FormatADI = "adi"
+	FormatADX = "adx"
+)
+
+// ParseFormat 检查格式名称，为空时返回 FormatADI
+func ParseFormat(s string) (string, error) {
+	switch f := strings.ToLower(strings.TrimSpace(s)); f {
+	case "", FormatADI:
+		return FormatADI, nil
+	case FormatADX:
+		return FormatADX, nil
+	default:
+		return "", fmt.Errorf("unknown log format %q, must be %s or %s", s, FormatADI, FormatADX)
+	}
+}
+
+// FormatOf 根据内容判断日志格式
+func FormatOf(data string) string {
+	if IsADX(data) {
+		return FormatADX
+	}
+	return FormatADI
+}
+
+// Convert 把 ADI 或 ADX 日志转换为指定格式，格式相同时原样返回
+func Convert(data []byte, format string) ([]byte, error) {
+	if FormatOf(string(data)) == format {
+		return data, nil
+	}
+	log, err := ReadLog(string(data))
+	if err != nil {
+		return nil, err
+	}
+	var b bytes.Buffer
+	if format == FormatADX {
+		err = log.WriteADX(&b, Header{})
+	} else {
+		err = log.WriteADI(&b, Header{})
+	}
+	if err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
@@ -0,0 +1,216 @@
+package adif
+
+import (
+	"bytes"
+	"maps"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+const sampleADX = `<?xml version="1.0" encoding="UTF-8"?>
+<ADX>
+<HEADER>
+<ADIF_VER>3.1.4</ADIF_VER>
+<PROGRAMID>test</PROGRAMID>
+<USERDEF FIELDID="1" TYPE="E" ENUM="{S,M,L}">SWEATERSIZE</USERDEF>
+</HEADER>
+<RECORDS>
+<RECORD>
+<CALL>K1ABC</CALL>
+<QSO_DATE>20240601</QSO_DATE>
+<TIME_ON>1200</TIME_ON>
+<COMMENT>a &lt;EOR&gt; &amp; 张三</COMMENT>
+<APP PROGRAMID="MONOLOG" FIELDNAME="Compression" TYPE="s">off</APP>
+<USERDEF FIELDNAME="SweaterSize">M</USERDEF>
+</RECORD>
+<RECORD><call>K2ABC</call><band>20m</band></RECORD>
+</RECORDS>
+</ADX>
+`
+
+func TestParseADX(t *testing.T) {
+	log, err := ParseADX(sampleADX)
+	if err != nil {
+		t.Fatalf("ParseADX() error = %v", err)
+	}
+	if !slices.Equal(log.UserDefs, []string{"sweatersize"}) {
+		t.Errorf("UserDefs = %q, want [sweatersize]", log.UserDefs)
+	}
+	if len(log.Records) != 2 {
+		t.Fatalf("got %d records, want 2", len(log.Records))
+	}
+	want := map[string]string{
+		"call": "K1ABC", "qso_date": "20240601", "time_on": "1200",
+		"comment": "a <EOR> & 张三", "app_monolog_compression": "off", "sweatersize": "M",
+	}
+	got := Parse(log.Records[0])
+	delete(got, "raw")
+	if !maps.Equal(got, want) {
+		t.Errorf("first record = %v, want %v", got, want)
+	}
+	if got := Parse(log.Records[1]); got["call"] != "K2ABC" || got["band"] != "20m" {
+		t.Errorf("second record = %v", got)
+	}
+}
+
+func TestParseADXErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want string
+		// records 是出错前已经解析出的记录数
+		records int
+	}{
+		{
+			name:    "truncated",
+			data:    `<ADX><RECORDS><RECORD><CALL>K1ABC</CALL></RECORD><RECORD><CALL>K2`,
+			want:    "invalid ADX",
+			records: 1,
+		},
+		{
+			name: "APP without FIELDNAME",
+			data: `<ADX><RECORDS><RECORD><APP PROGRAMID="X">1</APP></RECORD></RECORDS></ADX>`,
+			want: "APP element without PROGRAMID or FIELDNAME",
+		},
+		{
+			name: "USERDEF without FIELDNAME",
+			data: `<ADX><RECORDS><RECORD><USERDEF>1</USERDEF></RECORD></RECORDS></ADX>`,
+			want: "USERDEF element without FIELDNAME",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			log, err := ParseADX(tt.data)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("ParseADX() error = %v, want it to contain %q", err, tt.want)
+			}
+			if len(log.Records) != tt.records {
+				t.Errorf("got %d records before the error, want %d", len(log.Records), tt.records)
+			}
+			if got := SplitAny(tt.data); len(got) != tt.records {
+				t.Errorf("SplitAny() = %d records, want %d", len(got), tt.records)
+			}
+		})
+	}
+}
+
+func TestIsADX(t *testing.T) {
+	tests := []struct {
+		data string
+		want bool
+	}{
+		{`<?xml version="1.0"?><ADX></ADX>`, true},
+		{"\ufeff\n  <?xml version=\"1.0\"?>", true},
+		{"<adx><records></records></adx>", true},
+		{"<ADIF_VER:5>3.1.4<EOH><CALL:5>K1ABC<EOR>", false},
+		{"<CALL:5>K1ABC<EOR>", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := IsADX(tt.data); got != tt.want {
+			t.Errorf("IsADX(%q) = %v, want %v", tt.data, got, tt.want)
+		}
+	}
+}
+
+func TestReadLogADIUserDefs(t *testing.T) {
+	data := "<ADIF_VER:5>3.1.4<USERDEF1:19>SweaterSize,{S,M,L}<USERDEF2:5>Shoes<EOH><CALL:5>K1ABC<SWEATERSIZE:1>M<EOR>"
+	log, err := ReadLog(data)
+	if err != nil {
+		t.Fatalf("ReadLog() error = %v", err)
+	}
+	if !slices.Equal(log.UserDefs, []string{"sweatersize", "shoes"}) {
+		t.Errorf("UserDefs = %q, want [sweatersize shoes]", log.UserDefs)
+	}
+	if len(log.Records) != 1 {
+		t.Errorf("got %d records, want 1", len(log.Records))
+	}
+}
+
+func TestConvertRoundTrip(t *testing.T) {
+	adx, err := Convert([]byte(sampleADX), FormatADX)
+	if err != nil || !bytes.Equal(adx, []byte(sampleADX)) {
+		t.Fatalf("Convert() to the same format should return the input unchanged, error = %v", err)
+	}
+
+	adi, err := Convert([]byte(sampleADX), FormatADI)
+	if err != nil {
+		t.Fatalf("Convert() to ADI error = %v", err)
+	}
+	if FormatOf(string(adi)) != FormatADI {
+		t.Fatalf("Convert() to ADI returned %q", adi)
+	}
+	back, err := Convert(adi, FormatADX)
+	if err != nil {
+		t.Fatalf("Convert() back to ADX error = %v", err)
+	}
+
+	original, _ := ParseADX(sampleADX)
+	for name, data := range map[string][]byte{"ADI": adi, "ADX": back} {
+		log, err := ReadLog(string(data))
+		if err != nil {
+			t.Fatalf("ReadLog(%s) error = %v", name, err)
+		}
+		if !slices.Equal(log.UserDefs, original.UserDefs) {
+			t.Errorf("%s UserDefs = %q, want %q", name, log.UserDefs, original.UserDefs)
+		}
+		if len(log.Records) != len(original.Records) {
+			t.Fatalf("%s has %d records, want %d", name, len(log.Records), len(original.Records))
+		}
+		for i := range log.Records {
+			got, want := Parse(log.Records[i]), Parse(original.Records[i])
+			delete(got, "raw")
+			delete(want, "raw")
+			if !maps.Equal(got, want) {
+				t.Errorf("%s record %d = %v, want %v", name, i, got, want)
+			}
+		}
+	}
+}
+
+func TestWriteADX(t *testing.T) {
+	log := &Log{
+		UserDefs: []string{"sweatersize"},
+		Records:  []string{"<CALL:5>K1ABC<COMMENT:5>a & b<APP_MONOLOG_X:1>1<SWEATERSIZE:1>M<EOR>"},
+	}
+	var b bytes.Buffer
+	created := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	if err := log.WriteADX(&b, Header{ProgramID: "test", Created: created}); err != nil {
+		t.Fatalf("WriteADX() error = %v", err)
+	}
+	for _, want := range []string{
+		"<CREATED_TIMESTAMP>20240601 120000</CREATED_TIMESTAMP>",
+		`<USERDEF FIELDID="1">SWEATERSIZE</USERDEF>`,
+		"<COMMENT>a &amp; b</COMMENT>",
+		`<APP PROGRAMID="MONOLOG" FIELDNAME="X" TYPE="S">1</APP>`,
+		`<USERDEF FIELDNAME="SWEATERSIZE">M</USERDEF>`,
+	} {
+		if !strings.Contains(b.String(), want) {
+			t.Errorf("WriteADX() output does not contain %q:\n%s", want, b.String())
+		}
+	}
+
+	bad := &Log{Records: []string{"<APP_X:1>1<EOR>"}}
+	if err := bad.WriteADX(&bytes.Buffer{}, Header{}); err == nil {
+		t.Error("WriteADX() with an invalid APP field name expected an error")
+	}
+}
+
+func TestParseFormat(t *testing.T) {
+	for _, tt := range []struct {
+		in, want string
+		err      bool
+	}{
+		{"", FormatADI, false},
+		{"ADI", FormatADI, false},
+		{" adx ", FormatADX, false},
+		{"csv", "", true},
+	} {
+		got, err := ParseFormat(tt.in)
+		if got != tt.want || (err != nil) != tt.err {
+			t.Errorf("ParseFormat(%q) = %q, %v", tt.in, got, err)
+		}
+	}
+}
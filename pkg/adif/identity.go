@@ -0,0 +1,42 @@
+package adif
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"slices"
+	"strings"
+)
+
+// Identity 返回用于判断两条记录是否为同一个 QSO 的键，由呼号、日期、时间（精确到分钟）、波段和模式组成
+func Identity(fields map[string]string) string {
+	timeOn := fields["time_on"]
+	if len(timeOn) > 4 {
+		timeOn = timeOn[:4]
+	}
+	return strings.Join([]string{
+		strings.ToUpper(strings.TrimSpace(fields["call"])),
+		strings.TrimSpace(fields["qso_date"]),
+		timeOn,
+		strings.ToLower(strings.TrimSpace(fields["band"])),
+		strings.ToUpper(strings.TrimSpace(fields["mode"])),
+	}, "|")
+}
+
+// Fingerprint 返回记录所有字段的摘要，用于判断同一个 QSO 的内容是否被修改
+func Fingerprint(fields map[string]string) string {
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		if name != "raw" {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+	h := sha1.New()
+	for _, name := range names {
+		h.Write([]byte(name))
+		h.Write([]byte{0})
+		h.Write([]byte(fields[name]))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil)[:8])
+}
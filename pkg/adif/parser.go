@@ -27,8 +27,21 @@ func Parse(adif string) map[string]string {
 	return result
 }
 
+// FillTemplate 用记录的字段填充 text/template 模板，字段可以直接用 {{.call}} 引用，
+// 带类型的字段通过 qso 函数获得，例如 {{qso.Start.Format "2006-01-02"}} 或 {{qso.Freq}}
 func FillTemplate(t string, data map[string]string) (string, error) {
-	tmpl, err := template.New("body").Parse(t)
+	funcs := template.FuncMap{
+		// 无法转换的字段保持零值，不影响其他字段
+		"qso": func() *QSO {
+			if raw, ok := data["raw"]; ok {
+				q, _ := ParseQSO(raw)
+				return q
+			}
+			q, _ := QSOFromFields(data)
+			return q
+		},
+	}
+	tmpl, err := template.New("body").Funcs(funcs).Parse(t)
 	if err != nil {
 		return "", err
 	}
@@ -38,3 +51,45 @@ func FillTemplate(t string, data map[string]string) (string, error) {
 	}
 	return bodyBuffer.String(), nil
 }
+
+// Field 是记录中的一个字段，Type 是可选的类型标识
+type Field struct {
+	Name  string
+	Value string
+	Type  string
+}
+
+// ParseFields 按出现顺序返回一条 ADI 记录中的字段，字段名为小写，遇到 <EOR> 时停止
+func ParseFields(record string) []Field {
+	var fields []Field
+	for pos := 0; pos < len(record); {
+		lt := strings.IndexByte(record[pos:], '<')
+		if lt < 0 {
+			break
+		}
+		lt += pos
+		gt := strings.IndexByte(record[lt:], '>')
+		if gt < 0 {
+			break
+		}
+		gt += lt
+		name, length, ok := parseTag([]byte(record[lt+1 : gt]))
+		switch {
+		case !ok:
+			pos = lt + 1
+		case name == "eor":
+			return fields
+		case length < 0:
+			pos = gt + 1
+		default:
+			end := min(gt+1+length, len(record))
+			typ := ""
+			if parts := strings.Split(record[lt+1:gt], ":"); len(parts) == 3 {
+				typ = strings.ToUpper(strings.TrimSpace(parts[2]))
+			}
+			fields = append(fields, Field{Name: name, Value: record[gt+1 : end], Type: typ})
+			pos = end
+		}
+	}
+	return fields
+}
@@ -0,0 +1,320 @@
+package adif
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// QSO 是带类型的 QSO 记录。核心字段已经转换并校验，其余字段按出现顺序保存在 Extras 中
+type QSO struct {
+	Call string
+	// Start 和 End 是 UTC 时间，缺少日期或时间时为零值
+	Start time.Time
+	End   time.Time
+	// Freq 和 FreqRX 的单位是 Hz，缺少时为 0
+	Freq            int64
+	FreqRX          int64
+	Band            string
+	BandRX          string
+	Mode            string
+	Submode         string
+	Gridsquare      string
+	MyGridsquare    string
+	RSTSent         string
+	RSTRcvd         string
+	StationCallsign string
+	Extras          Extras
+}
+
+// FieldError 是某个字段无法转换为对应类型的错误
+type FieldError struct {
+	Field string
+	Value string
+	Err   error
+}
+
+func (e *FieldError) Error() string {
+	return fmt.Sprintf("field %s %q: %s", strings.ToUpper(e.Field), e.Value, e.Err)
+}
+
+func (e *FieldError) Unwrap() error {
+	return e.Err
+}
+
+// Extras 是保持插入顺序的字段集合，字段名为小写
+type Extras struct {
+	names  []string
+	values map[string]string
+}
+
+// Get 返回字段的值
+func (e *Extras) Get(name string) (string, bool) {
+	value, ok := e.values[strings.ToLower(name)]
+	return value, ok
+}
+
+// Set 设置字段的值，新字段排在最后
+func (e *Extras) Set(name, value string) {
+	name = strings.ToLower(name)
+	if e.values == nil {
+		e.values = make(map[string]string)
+	}
+	if _, ok := e.values[name]; !ok {
+		e.names = append(e.names, name)
+	}
+	e.values[name] = value
+}
+
+// Delete 删除字段
+func (e *Extras) Delete(name string) {
+	name = strings.ToLower(name)
+	if _, ok := e.values[name]; !ok {
+		return
+	}
+	delete(e.values, name)
+	e.names = slices.DeleteFunc(e.names, func(n string) bool { return n == name })
+}
+
+// Names 按顺序返回所有字段名
+func (e *Extras) Names() []string {
+	return slices.Clone(e.names)
+}
+
+// Len 返回字段数
+func (e *Extras) Len() int {
+	return len(e.names)
+}
+
+var gridPattern = regexp.MustCompile(`^[A-R]{2}([0-9]{2}([A-X]{2}([0-9]{2})?)?)?$`)
+
+// ParseQSO 把一条 ADI 记录转换为 QSO。无法转换的字段会被跳过并在返回的错误中逐个列出，
+// 错误是由 *FieldError 组成的 errors.Join，此时返回的 QSO 仍包含其余字段
+func ParseQSO(record string) (*QSO, error) {
+	fields := ParseFields(record)
+	m := make(map[string]string, len(fields))
+	var order []string
+	for _, f := range fields {
+		if _, ok := m[f.Name]; !ok {
+			order = append(order, f.Name)
+		}
+		m[f.Name] = f.Value
+	}
+	return newQSO(m, order)
+}
+
+// QSOFromFields 把 Parse 返回的字段转换为 QSO，Extras 按字段名排序
+func QSOFromFields(fields map[string]string) (*QSO, error) {
+	order := make([]string, 0, len(fields))
+	for name := range fields {
+		if name != "raw" {
+			order = append(order, name)
+		}
+	}
+	slices.Sort(order)
+	return newQSO(fields, order)
+}
+
+func newQSO(fields map[string]string, order []string) (*QSO, error) {
+	q := &QSO{}
+	var errs []error
+	fail := func(name string, err error) {
+		errs = append(errs, &FieldError{Field: name, Value: fields[name], Err: err})
+	}
+	get := func(name string) string {
+		return strings.TrimSpace(fields[name])
+	}
+
+	q.Call = strings.ToUpper(get("call"))
+	q.StationCallsign = strings.ToUpper(get("station_callsign"))
+	q.Mode = strings.ToUpper(get("mode"))
+	q.Submode = strings.ToUpper(get("submode"))
+	q.RSTSent = get("rst_sent")
+	q.RSTRcvd = get("rst_rcvd")
+
+	// 日期和时间分别校验，错误报告在出错的字段上
+	date := func(name string) time.Time {
+		t, err := parseDate(get(name))
+		if err != nil {
+			fail(name, err)
+		}
+		return t
+	}
+	clock := func(name string) (time.Duration, bool) {
+		d, ok, err := parseClock(get(name))
+		if err != nil {
+			fail(name, err)
+		}
+		return d, ok
+	}
+	startDate := date("qso_date")
+	endDate := startDate
+	if get("qso_date_off") != "" {
+		endDate = date("qso_date_off")
+	}
+	if on, ok := clock("time_on"); ok && !startDate.IsZero() {
+		q.Start = startDate.Add(on)
+	}
+	if off, ok := clock("time_off"); ok && !endDate.IsZero() {
+		q.End = endDate.Add(off)
+	}
+	// 没有结束日期且结束时间早于开始时间，说明 QSO 跨过了 UTC 零点
+	if get("qso_date_off") == "" && !q.End.IsZero() && q.End.Before(q.Start) {
+		q.End = q.End.AddDate(0, 0, 1)
+	}
+
+	var err error
+	for _, f := range []struct {
+		name string
+		hz   *int64
+	}{{"freq", &q.Freq}, {"freq_rx", &q.FreqRX}} {
+		if v := get(f.name); v != "" {
+			if *f.hz, err = parseFreq(v); err != nil {
+				fail(f.name, err)
+			}
+		}
+	}
+
+	for _, f := range []struct {
+		name string
+		band *string
+		hz   int64
+	}{{"band", &q.Band, q.Freq}, {"band_rx", &q.BandRX, q.FreqRX}} {
+		v := strings.ToLower(get(f.name))
+		switch {
+		case v != "" && !validBand(v):
+			fail(f.name, errors.New("unknown band"))
+		case v != "":
+			*f.band = v
+		case f.hz > 0:
+			// 没有波段时根据频率推算
+			*f.band = FreqToBand(float64(f.hz) / 1e6)
+		}
+	}
+
+	for _, f := range []struct {
+		name string
+		grid *string
+	}{{"gridsquare", &q.Gridsquare}, {"my_gridsquare", &q.MyGridsquare}} {
+		v := strings.ToUpper(get(f.name))
+		if v == "" {
+			continue
+		}
+		if !gridPattern.MatchString(v) {
+			fail(f.name, errors.New("invalid Maidenhead locator"))
+			continue
+		}
+		*f.grid = v
+	}
+
+	for _, name := range order {
+		if !slices.Contains(qsoFields, name) {
+			q.Extras.Set(name, fields[name])
+		}
+	}
+	return q, errors.Join(errs...)
+}
+
+// qsoFields 是 QSO 中有对应类型字段的 ADIF 字段，不会放入 Extras
+var qsoFields = []string{
+	"raw", "call", "station_callsign", "mode", "submode", "rst_sent", "rst_rcvd",
+	"qso_date", "time_on", "qso_date_off", "time_off",
+	"freq", "freq_rx", "band", "band_rx", "gridsquare", "my_gridsquare",
+}
+
+// Fields 把 QSO 转换回 ADIF 字段，可以交给 Writer 写出
+func (q *QSO) Fields() map[string]string {
+	fields := make(map[string]string, q.Extras.Len()+len(qsoFields))
+	for _, name := range q.Extras.names {
+		fields[name] = q.Extras.values[name]
+	}
+	set := func(name, value string) {
+		if value != "" {
+			fields[name] = value
+		}
+	}
+	set("call", q.Call)
+	set("station_callsign", q.StationCallsign)
+	set("mode", q.Mode)
+	set("submode", q.Submode)
+	set("rst_sent", q.RSTSent)
+	set("rst_rcvd", q.RSTRcvd)
+	set("band", q.Band)
+	set("band_rx", q.BandRX)
+	set("gridsquare", q.Gridsquare)
+	set("my_gridsquare", q.MyGridsquare)
+	if q.Freq > 0 {
+		fields["freq"] = formatFreq(q.Freq)
+	}
+	if q.FreqRX > 0 {
+		fields["freq_rx"] = formatFreq(q.FreqRX)
+	}
+	if !q.Start.IsZero() {
+		fields["qso_date"] = q.Start.Format("20060102")
+		fields["time_on"] = q.Start.Format("150405")
+	}
+	if !q.End.IsZero() {
+		fields["qso_date_off"] = q.End.Format("20060102")
+		fields["time_off"] = q.End.Format("150405")
+	}
+	return fields
+}
+
+// parseDate 解析 ADIF 的 YYYYMMDD 日期，为空时返回零值
+func parseDate(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.ParseInLocation("20060102", s, time.UTC)
+	if err != nil {
+		return time.Time{}, errors.New("date must be a valid YYYYMMDD")
+	}
+	return t, nil
+}
+
+// parseClock 解析 ADIF 的 HHMM 或 HHMMSS 时间，返回距离零点的时长，为空时 ok 为 false
+func parseClock(s string) (d time.Duration, ok bool, err error) {
+	if s == "" {
+		return 0, false, nil
+	}
+	layout := "150405"
+	switch len(s) {
+	case 4:
+		layout = "1504"
+	case 6:
+	default:
+		return 0, false, errors.New("time must be HHMM or HHMMSS")
+	}
+	t, err := time.Parse(layout, s)
+	if err != nil {
+		return 0, false, errors.New("time must be a valid HHMM or HHMMSS")
+	}
+	h, m, sec := t.Clock()
+	return time.Duration(h)*time.Hour + time.Duration(m)*time.Minute + time.Duration(sec)*time.Second, true, nil
+}
+
+// parseFreq 把以 MHz 为单位的频率转换为 Hz
+func parseFreq(s string) (int64, error) {
+	mhz, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, errors.New("not a number")
+	}
+	if mhz <= 0 {
+		return 0, errors.New("must be positive")
+	}
+	return int64(math.Round(mhz * 1e6)), nil
+}
+
+// formatFreq 把 Hz 转换为以 MHz 为单位、去掉末尾 0 的字符串
+func formatFreq(hz int64) string {
+	return strconv.FormatFloat(float64(hz)/1e6, 'f', -1, 64)
+}
+
+func validBand(name string) bool {
+	return slices.ContainsFunc(bands, func(b band) bool { return b.name == name })
+}
@@ -0,0 +1,188 @@
+package adif
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestParseQSOFieldErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		record string
+		want   []string
+	}{
+		{
+			name:   "valid record",
+			record: "<CALL:5>K1ABC<QSO_DATE:8>20240601<TIME_ON:4>1200<QSO_DATE_OFF:8>20240601<TIME_OFF:6>120530<BAND:3>20m<FREQ:6>14.074<EOR>",
+		},
+		{
+			name:   "invalid qso_date",
+			record: "<CALL:5>K1ABC<QSO_DATE:8>20241301<TIME_ON:4>1200<TIME_OFF:4>1210<EOR>",
+			want:   []string{"qso_date"},
+		},
+		{
+			name:   "invalid qso_date_off",
+			record: "<CALL:5>K1ABC<QSO_DATE:8>20240601<TIME_ON:4>1200<QSO_DATE_OFF:6>202406<TIME_OFF:4>1210<EOR>",
+			want:   []string{"qso_date_off"},
+		},
+		{
+			name:   "invalid times",
+			record: "<CALL:5>K1ABC<QSO_DATE:8>20240601<TIME_ON:3>120<TIME_OFF:4>2561<EOR>",
+			want:   []string{"time_on", "time_off"},
+		},
+		{
+			name:   "invalid frequency, band and locator",
+			record: "<CALL:5>K1ABC<FREQ:3>abc<FREQ_RX:2>-1<BAND:3>21m<GRIDSQUARE:4>ZZ99<MY_GRIDSQUARE:6>FN31pr<EOR>",
+			want:   []string{"freq", "freq_rx", "band", "gridsquare"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, err := ParseQSO(tt.record)
+			if q == nil {
+				t.Fatal("ParseQSO() returned nil QSO")
+			}
+			var got []string
+			if err != nil {
+				for _, e := range err.(interface{ Unwrap() []error }).Unwrap() {
+					var fe *FieldError
+					if !errors.As(e, &fe) {
+						t.Fatalf("error %v is not a *FieldError", e)
+					}
+					got = append(got, fe.Field)
+				}
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("ParseQSO() failed fields = %q, want %q (error: %v)", got, tt.want, err)
+			}
+		})
+	}
+}
+
+func TestParseQSOTimes(t *testing.T) {
+	tests := []struct {
+		name      string
+		record    string
+		wantStart time.Time
+		wantEnd   time.Time
+	}{
+		{
+			name:      "same day",
+			record:    "<CALL:5>K1ABC<QSO_DATE:8>20240601<TIME_ON:4>1200<TIME_OFF:6>121530<EOR>",
+			wantStart: time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC),
+			wantEnd:   time.Date(2024, 6, 1, 12, 15, 30, 0, time.UTC),
+		},
+		{
+			name:      "crosses midnight without qso_date_off",
+			record:    "<CALL:5>K1ABC<QSO_DATE:8>20241231<TIME_ON:4>2355<TIME_OFF:4>0005<EOR>",
+			wantStart: time.Date(2024, 12, 31, 23, 55, 0, 0, time.UTC),
+			wantEnd:   time.Date(2025, 1, 1, 0, 5, 0, 0, time.UTC),
+		},
+		{
+			name:      "qso_date_off is used as given",
+			record:    "<CALL:5>K1ABC<QSO_DATE:8>20240601<TIME_ON:4>2355<QSO_DATE_OFF:8>20240603<TIME_OFF:4>0005<EOR>",
+			wantStart: time.Date(2024, 6, 1, 23, 55, 0, 0, time.UTC),
+			wantEnd:   time.Date(2024, 6, 3, 0, 5, 0, 0, time.UTC),
+		},
+		{
+			name:      "missing time_off",
+			record:    "<CALL:5>K1ABC<QSO_DATE:8>20240601<TIME_ON:4>1200<EOR>",
+			wantStart: time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC),
+		},
+		{
+			name:   "missing qso_date",
+			record: "<CALL:5>K1ABC<TIME_ON:4>1200<TIME_OFF:4>1210<EOR>",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, err := ParseQSO(tt.record)
+			if err != nil {
+				t.Fatalf("ParseQSO() error = %v", err)
+			}
+			if !q.Start.Equal(tt.wantStart) || !q.End.Equal(tt.wantEnd) {
+				t.Errorf("ParseQSO() start, end = %v, %v, want %v, %v", q.Start, q.End, tt.wantStart, tt.wantEnd)
+			}
+		})
+	}
+}
+
+func TestParseQSOBand(t *testing.T) {
+	tests := []struct {
+		name       string
+		record     string
+		wantBand   string
+		wantBandRX string
+		wantFreq   int64
+	}{
+		{"band from frequency", "<CALL:5>K1ABC<FREQ:6>14.074<EOR>", "20m", "", 14074000},
+		{"band field wins", "<CALL:5>K1ABC<FREQ:6>14.074<BAND:3>40M<EOR>", "40m", "", 14074000},
+		{"rx band from rx frequency", "<CALL:5>K1ABC<FREQ:7>432.100<FREQ_RX:7>145.900<EOR>", "70cm", "2m", 432100000},
+		{"frequency outside every band", "<CALL:5>K1ABC<FREQ:3>100<EOR>", "", "", 100000000},
+		{"no frequency", "<CALL:5>K1ABC<EOR>", "", "", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, err := ParseQSO(tt.record)
+			if err != nil {
+				t.Fatalf("ParseQSO() error = %v", err)
+			}
+			if q.Band != tt.wantBand || q.BandRX != tt.wantBandRX || q.Freq != tt.wantFreq {
+				t.Errorf("ParseQSO() band, band_rx, freq = %q, %q, %d, want %q, %q, %d",
+					q.Band, q.BandRX, q.Freq, tt.wantBand, tt.wantBandRX, tt.wantFreq)
+			}
+		})
+	}
+}
+
+func TestQSOExtrasOrder(t *testing.T) {
+	q, err := ParseQSO("<NAME:3>Bob<CALL:5>K1ABC<QTH:6>Boston<COMMENT:2>73<BAND:3>20m<APP_X_ONE:1>1<EOR>")
+	if err != nil {
+		t.Fatalf("ParseQSO() error = %v", err)
+	}
+	want := []string{"name", "qth", "comment", "app_x_one"}
+	if got := q.Extras.Names(); !slices.Equal(got, want) {
+		t.Errorf("Extras.Names() = %q, want %q", got, want)
+	}
+
+	q.Extras.Set("QTH", "Cambridge")
+	q.Extras.Set("rig", "IC-7300")
+	q.Extras.Delete("comment")
+	want = []string{"name", "qth", "app_x_one", "rig"}
+	if got := q.Extras.Names(); !slices.Equal(got, want) {
+		t.Errorf("Extras.Names() after edits = %q, want %q", got, want)
+	}
+	if v, _ := q.Extras.Get("qth"); v != "Cambridge" {
+		t.Errorf("Extras.Get(qth) = %q, want Cambridge", v)
+	}
+
+	// QSOFromFields 没有原始顺序，Extras 按字段名排序
+	q, err = QSOFromFields(Parse("<NAME:3>Bob<CALL:5>K1ABC<QTH:6>Boston<COMMENT:2>73<EOR>"))
+	if err != nil {
+		t.Fatalf("QSOFromFields() error = %v", err)
+	}
+	want = []string{"comment", "name", "qth"}
+	if got := q.Extras.Names(); !slices.Equal(got, want) {
+		t.Errorf("QSOFromFields() Extras.Names() = %q, want %q", got, want)
+	}
+}
+
+func TestQSOFieldsRoundTrip(t *testing.T) {
+	record := "<CALL:5>K1ABC<QSO_DATE:8>20241231<TIME_ON:6>235500<TIME_OFF:6>000500<FREQ:6>14.074<MODE:3>FT8<NAME:3>Bob<EOR>"
+	q, err := ParseQSO(record)
+	if err != nil {
+		t.Fatalf("ParseQSO() error = %v", err)
+	}
+	fields := q.Fields()
+	for name, want := range map[string]string{
+		"call": "K1ABC", "qso_date": "20241231", "time_on": "235500",
+		"qso_date_off": "20250101", "time_off": "000500",
+		"freq": "14.074", "band": "20m", "mode": "FT8", "name": "Bob",
+	} {
+		if fields[name] != want {
+			t.Errorf("Fields()[%q] = %q, want %q", name, fields[name], want)
+		}
+	}
+}
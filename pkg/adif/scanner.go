@@ -0,0 +1,143 @@
+package adif
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+)
+
+// Scanner 是流式的 ADI 记录切分器。
+// 它按照 <FIELD:len> 中的长度读取字段值，标签不区分大小写，
+// 一次写入中的多条记录会被分别返回，<EOH> 之前的文件头会被丢弃。
+type Scanner struct {
+	buf []byte
+	// pos 是下一个待解析的位置
+	pos int
+	// start 是当前记录第一个字段的位置，-1 表示还没有遇到字段
+	start int
+}
+
+// NewScanner 创建一个新的 Scanner 实例
+func NewScanner() *Scanner {
+	return &Scanner{start: -1}
+}
+
+// Write 追加读取到的数据
+func (s *Scanner) Write(p []byte) (int, error) {
+	s.buf = append(s.buf, p...)
+	return len(p), nil
+}
+
+// Buffered 返回属于未完成记录、尚未被消费的字节数
+func (s *Scanner) Buffered() int {
+	return len(s.buf)
+}
+
+// Reset 丢弃所有未完成的数据
+func (s *Scanner) Reset() {
+	s.buf = nil
+	s.pos = 0
+	s.start = -1
+}
+
+// Next 返回下一条完整的记录（从第一个字段到 <EOR>），没有完整记录时返回 false
+func (s *Scanner) Next() (string, bool) {
+	for {
+		lt := bytes.IndexByte(s.buf[s.pos:], '<')
+		if lt < 0 {
+			if s.start < 0 {
+				// 记录之间的空白或文件头说明文字
+				s.drop(len(s.buf))
+			}
+			return "", false
+		}
+		lt += s.pos
+		gt := bytes.IndexByte(s.buf[lt:], '>')
+		if gt < 0 {
+			return "", false
+		}
+		gt += lt
+
+		name, length, ok := parseTag(s.buf[lt+1 : gt])
+		if !ok {
+			// 不是合法的标签，当作普通文字跳过
+			s.pos = lt + 1
+			continue
+		}
+
+		switch {
+		case length >= 0:
+			end := gt + 1 + length
+			if end > len(s.buf) {
+				return "", false
+			}
+			if s.start < 0 {
+				s.start = lt
+			}
+			s.pos = end
+		case name == "eoh":
+			s.start = -1
+			s.drop(gt + 1)
+		case name == "eor":
+			if s.start < 0 {
+				// 没有任何字段的空记录
+				s.drop(gt + 1)
+				continue
+			}
+			record := string(s.buf[s.start : gt+1])
+			s.start = -1
+			s.drop(gt + 1)
+			return record, true
+		default:
+			// 没有值的未知标签
+			s.pos = gt + 1
+		}
+	}
+}
+
+// drop 丢弃 buf 中 n 之前的数据
+func (s *Scanner) drop(n int) {
+	s.buf = s.buf[n:]
+	if len(s.buf) == 0 {
+		s.buf = nil
+	}
+	s.pos = 0
+	if s.start >= 0 {
+		s.start -= n
+	}
+}
+
+// parseTag 解析 <NAME:LEN:TYPE> 中尖括号内的部分，没有长度时 length 为 -1
+func parseTag(tag []byte) (name string, length int, ok bool) {
+	parts := strings.Split(string(tag), ":")
+	name = strings.ToLower(strings.TrimSpace(parts[0]))
+	if name == "" || strings.ContainsAny(name, " \t\r\n<") {
+		return "", 0, false
+	}
+	switch len(parts) {
+	case 1:
+		return name, -1, true
+	case 2, 3:
+		length, err := strconv.Atoi(strings.TrimSpace(parts[1]))
+		if err != nil || length < 0 {
+			return "", 0, false
+		}
+		return name, length, true
+	default:
+		return "", 0, false
+	}
+}
+
+// Split 把一段完整的 ADI 文本切分成记录
+func Split(data string) []string {
+	s := NewScanner()
+	s.Write([]byte(data))
+	var records []string
+	for {
+		record, ok := s.Next()
+		if !ok {
+			return records
+		}
+		records = append(records, record)
+	}
+}
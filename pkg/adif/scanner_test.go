@@ -0,0 +1,144 @@
+package adif
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestSplit(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want []string
+	}{
+		{
+			name: "header and records",
+			data: "Exported log\n<ADIF_VER:5>3.1.4 <EOH>\n<CALL:5>K1ABC<BAND:3>20m<EOR>\n<CALL:5>K2ABC<BAND:3>40m<EOR>\n",
+			want: []string{"<CALL:5>K1ABC<BAND:3>20m<EOR>", "<CALL:5>K2ABC<BAND:3>40m<EOR>"},
+		},
+		{
+			name: "no header",
+			data: "<CALL:5>K1ABC<EOR>",
+			want: []string{"<CALL:5>K1ABC<EOR>"},
+		},
+		{
+			name: "lower case tags and type indicators",
+			data: "<eoh><call:5>K1ABC<qso_date:8:d>20240601<eor>",
+			want: []string{"<call:5>K1ABC<qso_date:8:d>20240601<eor>"},
+		},
+		{
+			name: "value containing tags is read by length",
+			data: "<CALL:5>K1ABC<COMMENT:11>a <EOR> b c<EOR>",
+			want: []string{"<CALL:5>K1ABC<COMMENT:11>a <EOR> b c<EOR>"},
+		},
+		{
+			name: "multi-byte value",
+			data: "<NAME:6>张三<CALL:5>BG2AB<EOR>",
+			want: []string{"<NAME:6>张三<CALL:5>BG2AB<EOR>"},
+		},
+		{
+			name: "empty records are skipped",
+			data: "<EOR>\n<EOR><CALL:5>K1ABC<EOR>",
+			want: []string{"<CALL:5>K1ABC<EOR>"},
+		},
+		{
+			name: "text that is not a tag",
+			data: "a < b > c <CALL:5>K1ABC<EOR>",
+			want: []string{"<CALL:5>K1ABC<EOR>"},
+		},
+		{
+			name: "incomplete record",
+			data: "<CALL:5>K1ABC<EOR><CALL:5>K2A",
+			want: []string{"<CALL:5>K1ABC<EOR>"},
+		},
+		{
+			name: "empty",
+			data: "",
+			want: nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Split(tt.data); !slices.Equal(got, tt.want) {
+				t.Errorf("Split() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScannerStreaming(t *testing.T) {
+	data := "Header <EOH>\n<CALL:5>K1ABC<COMMENT:7>a <b> c<EOR>\n<CALL:5>K2ABC<NAME:6>张三<EOR>\n"
+	want := []string{"<CALL:5>K1ABC<COMMENT:7>a <b> c<EOR>", "<CALL:5>K2ABC<NAME:6>张三<EOR>"}
+
+	// 在每一个字节处切开，结果都应相同
+	for cut := 0; cut <= len(data); cut++ {
+		s := NewScanner()
+		var got []string
+		for _, part := range []string{data[:cut], data[cut:]} {
+			s.Write([]byte(part))
+			for {
+				record, ok := s.Next()
+				if !ok {
+					break
+				}
+				got = append(got, record)
+			}
+		}
+		if !slices.Equal(got, want) {
+			t.Fatalf("cut at %d: got %q, want %q", cut, got, want)
+		}
+		if s.Buffered() != 0 {
+			// 记录之后的换行不属于任何记录
+			t.Fatalf("cut at %d: Buffered() = %d, want 0", cut, s.Buffered())
+		}
+	}
+}
+
+func TestScannerBuffered(t *testing.T) {
+	s := NewScanner()
+	s.Write([]byte("<CALL:5>K1ABC<EOR><CALL:5>K2"))
+	if _, ok := s.Next(); !ok {
+		t.Fatal("expected a record")
+	}
+	if _, ok := s.Next(); ok {
+		t.Fatal("expected no complete record")
+	}
+	// 未完成的记录从 <CALL:5>K2 开始
+	if got, want := s.Buffered(), len("<CALL:5>K2"); got != want {
+		t.Errorf("Buffered() = %d, want %d", got, want)
+	}
+
+	s.Reset()
+	if s.Buffered() != 0 {
+		t.Errorf("Buffered() after Reset = %d, want 0", s.Buffered())
+	}
+	s.Write([]byte("<CALL:5>K3ABC<EOR>"))
+	if record, ok := s.Next(); !ok || record != "<CALL:5>K3ABC<EOR>" {
+		t.Errorf("Next() after Reset = %q, %v", record, ok)
+	}
+}
+
+func TestParseTag(t *testing.T) {
+	tests := []struct {
+		tag    string
+		name   string
+		length int
+		ok     bool
+	}{
+		{"CALL:5", "call", 5, true},
+		{"QSO_DATE:8:D", "qso_date", 8, true},
+		{"EOR", "eor", -1, true},
+		{" eoh ", "eoh", -1, true},
+		{"CALL:x", "", 0, false},
+		{"CALL:-1", "", 0, false},
+		{"CALL:1:2:3", "", 0, false},
+		{"", "", 0, false},
+		{"a b", "", 0, false},
+	}
+	for _, tt := range tests {
+		name, length, ok := parseTag([]byte(tt.tag))
+		if name != tt.name || length != tt.length || ok != tt.ok {
+			t.Errorf("parseTag(%q) = %q, %d, %v, want %q, %d, %v", tt.tag, name, length, ok, tt.name, tt.length, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package adif
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Version 是写出的文件头中的 ADIF_VER
+const Version = "3.1.4"
+
+// coreFields 是写出记录时排在最前面的字段，其余字段按名称排序
+var coreFields = []string{
+	"call", "qso_date", "time_on", "qso_date_off", "time_off",
+	"band", "band_rx", "freq", "freq_rx", "mode", "submode",
+	"rst_sent", "rst_rcvd", "station_callsign", "operator",
+	"gridsquare", "my_gridsquare", "prop_mode", "sat_name",
+}
+
+// StandardTypes 是常用 ADIF 字段的类型标识，可以赋给 Writer.Types
+var StandardTypes = map[string]string{
+	"qso_date":     "D",
+	"qso_date_off": "D",
+	"time_on":      "T",
+	"time_off":     "T",
+	"freq":         "N",
+	"freq_rx":      "N",
+	"tx_pwr":       "N",
+	"rx_pwr":       "N",
+	"dxcc":         "N",
+	"my_dxcc":      "N",
+	"cqz":          "N",
+	"ituz":         "N",
+	"lat":          "L",
+	"lon":          "L",
+	"my_lat":       "L",
+	"my_lon":       "L",
+}
+
+// Header 是 ADI 文件头中的信息，ProgramID 为空时使用 adif2cloud，Created 为空时使用当前时间
+type Header struct {
+	Comment        string
+	ProgramID      string
+	ProgramVersion string
+	Created        time.Time
+	// UserDefs 是记录中用到的用户自定义字段名，写为 <USERDEFn>
+	UserDefs []string
+}
+
+// Writer 写出符合 ADIF 规范的 ADI 文本。字段长度是值的 UTF-8 字节数，
+// 字段顺序固定，同一条记录每次写出的内容都相同
+type Writer struct {
+	w io.Writer
+	// Types 不为 nil 时，为其中列出的字段写出类型标识，例如 <QSO_DATE:8:D>
+	Types map[string]string
+}
+
+// NewWriter 创建一个新的 Writer 实例
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: w}
+}
+
+func (h Header) withDefaults() Header {
+	if h.ProgramID == "" {
+		h.ProgramID = "adif2cloud"
+	}
+	if h.Created.IsZero() {
+		h.Created = time.Now()
+	}
+	return h
+}
+
+// WriteHeader 写出以 <EOH> 结尾的文件头
+func (w *Writer) WriteHeader(h Header) error {
+	h = h.withDefaults()
+	comment := h.Comment
+	if comment == "" {
+		comment = "Generated by " + h.ProgramID
+	}
+	// 说明文字不能以 < 开头，否则会被当作字段
+	comment = strings.TrimLeft(comment, "<")
+
+	var b strings.Builder
+	b.WriteString(comment)
+	b.WriteString("\n")
+	writeField(&b, "adif_ver", Version, "")
+	writeField(&b, "programid", h.ProgramID, "")
+	if h.ProgramVersion != "" {
+		writeField(&b, "programversion", h.ProgramVersion, "")
+	}
+	writeField(&b, "created_timestamp", h.Created.UTC().Format("20060102 150405"), "")
+	for i, name := range h.UserDefs {
+		writeField(&b, fmt.Sprintf("userdef%d", i+1), strings.ToUpper(name), "")
+	}
+	b.WriteString("<EOH>\n")
+	_, err := io.WriteString(w.w, b.String())
+	return err
+}
+
+// WriteRecord 写出一条以 <EOR> 结尾的记录，忽略 raw 和空值
+func (w *Writer) WriteRecord(fields map[string]string) error {
+	var b strings.Builder
+	for _, name := range FieldOrder(fields) {
+		if !validName(name) {
+			return fmt.Errorf("invalid ADIF field name %q", name)
+		}
+		writeField(&b, name, fields[name], w.Types[name])
+	}
+	b.WriteString("<EOR>\n")
+	_, err := io.WriteString(w.w, b.String())
+	return err
+}
+
+// FieldOrder 返回写出记录时的字段顺序：coreFields 中的字段在前，其余按名称排序。
+// raw 和空值不包含在内
+func FieldOrder(fields map[string]string) []string {
+	var core, rest []string
+	for name, value := range fields {
+		if name == "raw" || value == "" {
+			continue
+		}
+		if slices.Contains(coreFields, name) {
+			core = append(core, name)
+		} else {
+			rest = append(rest, name)
+		}
+	}
+	slices.SortFunc(core, func(a, b string) int {
+		return slices.Index(coreFields, a) - slices.Index(coreFields, b)
+	})
+	slices.Sort(rest)
+	return append(core, rest...)
+}
+
+func writeField(b *strings.Builder, name, value, typ string) {
+	if typ != "" {
+		fmt.Fprintf(b, "<%s:%d:%s>%s ", strings.ToUpper(name), len(value), typ, value)
+		return
+	}
+	fmt.Fprintf(b, "<%s:%d>%s ", strings.ToUpper(name), len(value), value)
+}
+
+// validName 判断字段名是否可以写入 ADI，规范不允许逗号、冒号、尖括号、花括号和空白
+func validName(name string) bool {
+	return name != "" && !strings.ContainsAny(name, ",:<>{} \t\r\n")
+}
+
+// FormatRecord 把 Parse 返回的字段序列化为一条以 <EOR> 结尾的 ADI 记录，不包含换行
+func FormatRecord(fields map[string]string) (string, error) {
+	var b strings.Builder
+	if err := NewWriter(&b).WriteRecord(fields); err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(b.String(), "\n"), nil
+}
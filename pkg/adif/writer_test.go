@@ -0,0 +1,188 @@
+package adif
+
+import (
+	"maps"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFormatRecordRoundTrip(t *testing.T) {
+	tests := []struct {
+		name   string
+		fields map[string]string
+	}{
+		{
+			name: "basic",
+			fields: map[string]string{
+				"call": "K1ABC", "qso_date": "20240601", "time_on": "1200",
+				"band": "20m", "mode": "CW", "rst_sent": "599", "rst_rcvd": "579",
+			},
+		},
+		{
+			name: "multi-byte UTF-8",
+			fields: map[string]string{
+				"call": "BG2ABC", "qso_date": "20240601", "time_on": "120000",
+				"name": "张三", "qth": "Zürich", "comment": "73 ✓ ありがとう",
+			},
+		},
+		{
+			name: "value containing tag characters",
+			fields: map[string]string{
+				"call": "DL1XYZ", "qso_date": "20240601", "time_on": "1200",
+				"comment": "a <b> c <EOR> d",
+				"notes":   "line 1\nline 2",
+			},
+		},
+		{
+			name: "user defined and application fields",
+			fields: map[string]string{
+				"call": "JA1ABC", "qso_date": "20240601", "time_on": "1200",
+				"app_n1mm_id": "abc123", "myfield": "x",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			record, err := FormatRecord(tt.fields)
+			if err != nil {
+				t.Fatalf("FormatRecord() error = %v", err)
+			}
+			got := Parse(record)
+			delete(got, "raw")
+			if !maps.Equal(got, tt.fields) {
+				t.Errorf("Parse(FormatRecord()) = %v, want %v\nrecord: %s", got, tt.fields, record)
+			}
+			if split := Split(record); len(split) != 1 || split[0] != record {
+				t.Errorf("Split(FormatRecord()) = %q, want [%q]", split, record)
+			}
+		})
+	}
+}
+
+func TestFormatRecordLengthIsBytes(t *testing.T) {
+	record, err := FormatRecord(map[string]string{"call": "BG2ABC", "name": "张三"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 张三 在 UTF-8 中占 6 个字节
+	if !strings.Contains(record, "<NAME:6>张三 ") {
+		t.Errorf("record = %q, want <NAME:6>张三", record)
+	}
+}
+
+func TestFormatRecordSkipsRawAndEmpty(t *testing.T) {
+	record, err := FormatRecord(map[string]string{"call": "K1ABC", "raw": "<CALL:5>K1ABC<EOR>", "comment": ""})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "<CALL:5>K1ABC <EOR>"; record != want {
+		t.Errorf("FormatRecord() = %q, want %q", record, want)
+	}
+}
+
+func TestFormatRecordInvalidName(t *testing.T) {
+	for _, name := range []string{"my field", "a:b", "a<b", "a,b", "{x}"} {
+		if _, err := FormatRecord(map[string]string{"call": "K1ABC", name: "x"}); err == nil {
+			t.Errorf("FormatRecord() with field %q: expected an error", name)
+		}
+	}
+}
+
+func TestFieldOrder(t *testing.T) {
+	fields := map[string]string{
+		"comment": "x", "mode": "CW", "call": "K1ABC", "band": "20m",
+		"time_on": "1200", "qso_date": "20240601", "app_x": "1", "raw": "r", "name": "",
+	}
+	got := FieldOrder(fields)
+	want := []string{"call", "qso_date", "time_on", "band", "mode", "app_x", "comment"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("FieldOrder() = %v, want %v", got, want)
+	}
+
+	// 同一条记录每次写出的内容都相同
+	first, _ := FormatRecord(fields)
+	for range 10 {
+		if again, _ := FormatRecord(fields); again != first {
+			t.Fatalf("FormatRecord() is not deterministic: %q != %q", again, first)
+		}
+	}
+}
+
+func TestWriteRecordTypes(t *testing.T) {
+	var b strings.Builder
+	w := NewWriter(&b)
+	w.Types = StandardTypes
+	fields := map[string]string{"call": "K1ABC", "qso_date": "20240601", "time_on": "1200", "freq": "14.025"}
+	if err := w.WriteRecord(fields); err != nil {
+		t.Fatal(err)
+	}
+	record := b.String()
+	for _, tag := range []string{"<CALL:5>", "<QSO_DATE:8:D>", "<TIME_ON:4:T>", "<FREQ:6:N>"} {
+		if !strings.Contains(record, tag) {
+			t.Errorf("record %q does not contain %s", record, tag)
+		}
+	}
+
+	parsed := ParseFields(record)
+	types := make(map[string]string)
+	for _, f := range parsed {
+		types[f.Name] = f.Type
+	}
+	if types["qso_date"] != "D" || types["time_on"] != "T" || types["freq"] != "N" || types["call"] != "" {
+		t.Errorf("ParseFields() types = %v", types)
+	}
+	got := Parse(record)
+	delete(got, "raw")
+	if !maps.Equal(got, fields) {
+		t.Errorf("Parse() = %v, want %v", got, fields)
+	}
+}
+
+func TestWriteHeader(t *testing.T) {
+	var b strings.Builder
+	w := NewWriter(&b)
+	created := time.Date(2024, 6, 1, 12, 30, 45, 0, time.UTC)
+	err := w.WriteHeader(Header{
+		Comment:        "<export",
+		ProgramVersion: "1.2.3",
+		Created:        created,
+		UserDefs:       []string{"myfield", "other"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.WriteRecord(map[string]string{"call": "K1ABC", "qso_date": "20240601", "time_on": "1200"}); err != nil {
+		t.Fatal(err)
+	}
+	data := b.String()
+
+	header, body, ok := strings.Cut(data, "<EOH>")
+	if !ok {
+		t.Fatalf("no <EOH> in %q", data)
+	}
+	if strings.HasPrefix(header, "<") {
+		t.Errorf("header comment starts with <: %q", header)
+	}
+	for _, want := range []string{
+		"<ADIF_VER:5>" + Version,
+		"<PROGRAMID:10>adif2cloud",
+		"<PROGRAMVERSION:5>1.2.3",
+		"<CREATED_TIMESTAMP:15>20240601 123045",
+		"<USERDEF1:7>MYFIELD",
+		"<USERDEF2:5>OTHER",
+	} {
+		if !strings.Contains(header, want) {
+			t.Errorf("header %q does not contain %s", header, want)
+		}
+	}
+
+	// 文件头中的字段不能被当作记录
+	records := Split(data)
+	if len(records) != 1 || !strings.HasPrefix(records[0], "<CALL:5>") {
+		t.Errorf("Split() = %q, want one record", records)
+	}
+	if got := Parse(records[0])["call"]; got != "K1ABC" {
+		t.Errorf("call = %q, want K1ABC (body %q)", got, body)
+	}
+}
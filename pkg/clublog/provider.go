@@ -1,28 +1,51 @@
 package clublog
 
 import (
+	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"log/slog"
+	"mime/multipart"
 	"net/http"
 	"net/url"
 	"strings"
 
 	"git.esd.cc/imlonghao/adif2cloud/internal/consts"
+	"git.esd.cc/imlonghao/adif2cloud/pkg/adif"
+	"git.esd.cc/imlonghao/adif2cloud/pkg/provider"
 
 	"github.com/projectdiscovery/retryablehttp-go"
 )
 
+const (
+	// batchRecords 和 batchBytes 是单次 putlogs 上传的上限，
+	// Club Log 对上传文件有大小限制，并建议大量 QSO 分多次上传
+	batchRecords = 5000
+	batchBytes   = 4 << 20
+)
+
 // ClubLogConfig 定义了 Club Log 配置
 type ClubLogConfig struct {
-	Email    string `mapstructure:"email"`
-	Password string `mapstructure:"password"`
-	Callsign string `mapstructure:"callsign"`
+	Email    string `mapstructure:"email" required:"true"`
+	Password string `mapstructure:"password" required:"true"`
+	Callsign string `mapstructure:"callsign" required:"true"`
+}
+
+func init() {
+	provider.Register("clublog", func(cfg ClubLogConfig) (provider.Provider, error) {
+		p := NewClubLogProvider(cfg)
+		if p == nil {
+			return nil, fmt.Errorf("club log API key is not set in this build")
+		}
+		return p, nil
+	})
 }
 
 // ClubLogProvider 实现了 Provider 接口，用于 Club Log 服务
 type ClubLogProvider struct {
 	config ClubLogConfig
+	client *retryablehttp.Client
 }
 
 // NewClubLogProvider 创建一个新的 ClubLogProvider 实例
@@ -36,23 +59,24 @@ func NewClubLogProvider(cfg ClubLogConfig) *ClubLogProvider {
 		"callsign", cfg.Callsign)
 	return &ClubLogProvider{
 		config: cfg,
+		client: retryablehttp.NewClient(retryablehttp.DefaultOptionsSingle),
 	}
 }
 
 // GetSize 获取 Club Log 上 ADIF 文件的大小
-func (p *ClubLogProvider) GetSize() (int64, error) {
+func (p *ClubLogProvider) GetSize(_ context.Context) (int64, error) {
 	// Club Log 不直接提供文件大小，返回 0
 	return 0, nil
 }
 
 // Download 从 Club Log 下载 ADIF 文件
-func (p *ClubLogProvider) Download(w io.Writer) error {
+func (p *ClubLogProvider) Download(_ context.Context, w io.Writer) error {
 	// Club Log 不直接提供下载功能，返回错误
 	return fmt.Errorf("club log does not support direct file download")
 }
 
 // Upload 上传 QSO 记录到 Club Log
-func (p *ClubLogProvider) Upload(_ string, line string) error {
+func (p *ClubLogProvider) Upload(ctx context.Context, _ string, line string) error {
 	// 准备表单数据
 	formData := url.Values{}
 	formData.Set("email", p.config.Email)
@@ -62,14 +86,13 @@ func (p *ClubLogProvider) Upload(_ string, line string) error {
 	formData.Set("api", consts.ClubLogAPIKey)
 
 	// 发送 POST 请求
-	client := retryablehttp.NewClient(retryablehttp.DefaultOptionsSingle)
-	req, err := retryablehttp.NewRequest(http.MethodPost, "https://clublog.org/realtime.php", strings.NewReader(formData.Encode()))
+	req, err := retryablehttp.NewRequestWithContext(ctx, http.MethodPost, "https://clublog.org/realtime.php", strings.NewReader(formData.Encode()))
 	if err != nil {
 		return fmt.Errorf("failed to create request: %w", err)
 	}
 	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 	req.Header.Set("User-Agent", fmt.Sprintf("adif2cloud/%s (+https://git.esd.cc/imlonghao/adif2cloud)", consts.Version))
-	resp, err := client.Do(req)
+	resp, err := p.client.Do(req)
 	if err != nil {
 		return fmt.Errorf("failed to send request: %w", err)
 	}
@@ -77,20 +100,71 @@ func (p *ClubLogProvider) Upload(_ string, line string) error {
 
 	// 检查响应状态码
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+		body, _ := io.ReadAll(resp.Body)
+		return provider.StatusError(resp.StatusCode, string(body))
 	}
 
-	// 读取响应内容
-	body, err := io.ReadAll(resp.Body)
+	return nil
+}
+
+// UploadBatch 通过 putlogs 接口批量上传 QSO 记录到 Club Log。
+// putlogs 在后台导入，只返回整个文件是否被接受，所以一批中的记录共享同一个结果
+func (p *ClubLogProvider) UploadBatch(ctx context.Context, _ string, lines []string) []error {
+	errs := make([]error, 0, len(lines))
+	for _, batch := range provider.Batches(lines, batchRecords, batchBytes) {
+		errs = append(errs, provider.Fill(len(batch), p.putLogs(ctx, batch))...)
+	}
+	return errs
+}
+
+// putLogs 把记录作为一个 ADIF 文件上传到 Club Log，不清空已有的日志
+func (p *ClubLogProvider) putLogs(ctx context.Context, lines []string) error {
+	ctx, cancel := provider.RequestContext(ctx)
+	defer cancel()
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	for name, value := range map[string]string{
+		"email":    p.config.Email,
+		"password": p.config.Password,
+		"callsign": p.config.Callsign,
+		"api":      consts.ClubLogAPIKey,
+		"clear":    "0",
+	} {
+		if err := form.WriteField(name, value); err != nil {
+			return fmt.Errorf("failed to create form: %w", err)
+		}
+	}
+	file, err := form.CreateFormFile("file", "adif2cloud.adi")
 	if err != nil {
-		return fmt.Errorf("failed to read response: %w", err)
+		return fmt.Errorf("failed to create form: %w", err)
+	}
+	if err := adif.NewWriter(file).WriteHeader(adif.Header{ProgramVersion: consts.Version}); err != nil {
+		return fmt.Errorf("failed to create form: %w", err)
+	}
+	for _, line := range lines {
+		fmt.Fprintln(file, line)
+	}
+	if err := form.Close(); err != nil {
+		return fmt.Errorf("failed to create form: %w", err)
 	}
 
-	// 检查状态码
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("unexpected status code: %d, body: %s", resp.StatusCode, string(body))
+	req, err := retryablehttp.NewRequestWithContext(ctx, http.MethodPost, "https://clublog.org/putlogs.php", body.Bytes())
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	req.Header.Set("User-Agent", fmt.Sprintf("adif2cloud/%s (+https://git.esd.cc/imlonghao/adif2cloud)", consts.Version))
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
 	}
+	defer resp.Body.Close()
 
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(resp.Body)
+		return provider.StatusError(resp.StatusCode, string(respBody))
+	}
 	return nil
 }
 
@@ -0,0 +1,420 @@
+// Package expr 实现了用于路由和过滤 QSO 的表达式语言。
+//
+// 表达式只能读取记录中的字段并调用内置函数，不能修改任何状态，例如：
+//
+//	band == "2m" && prop_mode == "SAT"
+//	station_callsign =~ "/P$" || dxcc(291, 110)
+//
+// 标识符是 ADIF 字段名（不区分大小写），缺少的字段为空字符串。
+// 字符串比较不区分大小写；两边都是数字时按数值比较。
+package expr
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Program 是编译后的表达式，可以在多个 goroutine 中同时使用
+type Program struct {
+	src  string
+	root node
+}
+
+// Compile 解析表达式，检查函数名、参数个数、正则表达式字面量和函数的字面量参数
+func Compile(src string) (*Program, error) {
+	tokens, err := lex(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokEOF {
+		return nil, fmt.Errorf("at %d: unexpected %q", t.pos, t.text)
+	}
+	return &Program{src: src, root: root}, nil
+}
+
+// Eval 对 adif.Parse 解析出的记录求值，结果按真值判断：
+// 布尔值取其本身，字符串非空为真，数字非零为真
+func (p *Program) Eval(fields map[string]string) (bool, error) {
+	v, err := p.root.eval(fields)
+	if err != nil {
+		return false, err
+	}
+	return truthy(v), nil
+}
+
+// String 返回表达式的原文
+func (p *Program) String() string {
+	return p.src
+}
+
+// value 是求值的结果，类型为 string、float64 或 bool
+type value interface{}
+
+type node interface {
+	eval(fields map[string]string) (value, error)
+}
+
+type literal struct{ v value }
+
+func (n literal) eval(map[string]string) (value, error) { return n.v, nil }
+
+type field struct{ name string }
+
+func (n field) eval(fields map[string]string) (value, error) {
+	return strings.TrimSpace(fields[n.name]), nil
+}
+
+type not struct{ x node }
+
+func (n not) eval(fields map[string]string) (value, error) {
+	v, err := n.x.eval(fields)
+	if err != nil {
+		return nil, err
+	}
+	return !truthy(v), nil
+}
+
+type logical struct {
+	op   string
+	l, r node
+}
+
+func (n logical) eval(fields map[string]string) (value, error) {
+	l, err := n.l.eval(fields)
+	if err != nil {
+		return nil, err
+	}
+	// 短路求值
+	if n.op == "&&" && !truthy(l) {
+		return false, nil
+	}
+	if n.op == "||" && truthy(l) {
+		return true, nil
+	}
+	r, err := n.r.eval(fields)
+	if err != nil {
+		return nil, err
+	}
+	return truthy(r), nil
+}
+
+type compare struct {
+	op   string
+	l, r node
+}
+
+func (n compare) eval(fields map[string]string) (value, error) {
+	l, err := n.l.eval(fields)
+	if err != nil {
+		return nil, err
+	}
+	r, err := n.r.eval(fields)
+	if err != nil {
+		return nil, err
+	}
+	if lb, ok := l.(bool); ok {
+		if n.op != "==" && n.op != "!=" {
+			return nil, fmt.Errorf("operator %s cannot be used with booleans", n.op)
+		}
+		return (lb == truthy(r)) == (n.op == "=="), nil
+	}
+	if rb, ok := r.(bool); ok {
+		if n.op != "==" && n.op != "!=" {
+			return nil, fmt.Errorf("operator %s cannot be used with booleans", n.op)
+		}
+		return (rb == truthy(l)) == (n.op == "=="), nil
+	}
+
+	var c int
+	lf, lok := toNumber(l)
+	rf, rok := toNumber(r)
+	if lok && rok {
+		switch {
+		case lf < rf:
+			c = -1
+		case lf > rf:
+			c = 1
+		}
+	} else {
+		c = strings.Compare(strings.ToUpper(toString(l)), strings.ToUpper(toString(r)))
+	}
+	switch n.op {
+	case "==":
+		return c == 0, nil
+	case "!=":
+		return c != 0, nil
+	case "<":
+		return c < 0, nil
+	case "<=":
+		return c <= 0, nil
+	case ">":
+		return c > 0, nil
+	default:
+		return c >= 0, nil
+	}
+}
+
+type match struct {
+	negate bool
+	x      node
+	re     *regexp.Regexp
+	// pattern 在正则不是字面量时使用，每次求值时编译
+	pattern node
+}
+
+func (n match) eval(fields map[string]string) (value, error) {
+	v, err := n.x.eval(fields)
+	if err != nil {
+		return nil, err
+	}
+	re := n.re
+	if re == nil {
+		pattern, err := n.pattern.eval(fields)
+		if err != nil {
+			return nil, err
+		}
+		if re, err = regexp.Compile(toString(pattern)); err != nil {
+			return nil, fmt.Errorf("invalid regex: %w", err)
+		}
+	}
+	return re.MatchString(toString(v)) != n.negate, nil
+}
+
+type call struct {
+	fn   *function
+	args []node
+}
+
+func (n call) eval(fields map[string]string) (value, error) {
+	args := make([]value, len(n.args))
+	for i, arg := range n.args {
+		v, err := arg.eval(fields)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = v
+	}
+	v, err := n.fn.call(fields, args)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", n.fn.name, err)
+	}
+	return v, nil
+}
+
+func truthy(v value) bool {
+	switch v := v.(type) {
+	case bool:
+		return v
+	case float64:
+		return v != 0
+	case string:
+		return v != ""
+	default:
+		return false
+	}
+}
+
+func toNumber(v value) (float64, bool) {
+	switch v := v.(type) {
+	case float64:
+		return v, true
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		return f, err == nil
+	default:
+		return 0, false
+	}
+}
+
+func toString(v value) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	default:
+		return ""
+	}
+}
+
+// parser 是递归下降解析器，优先级从低到高为 ||、&&、比较、!
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) parseOr() (node, error) {
+	l, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().kind == tokOp && p.peek().text == "||" {
+		p.next()
+		r, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		l = logical{op: "||", l: l, r: r}
+	}
+	return l, nil
+}
+
+func (p *parser) parseAnd() (node, error) {
+	l, err := p.parseCompare()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().kind == tokOp && p.peek().text == "&&" {
+		p.next()
+		r, err := p.parseCompare()
+		if err != nil {
+			return nil, err
+		}
+		l = logical{op: "&&", l: l, r: r}
+	}
+	return l, nil
+}
+
+func (p *parser) parseCompare() (node, error) {
+	l, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	t := p.peek()
+	if t.kind != tokOp {
+		return l, nil
+	}
+	switch t.text {
+	case "==", "!=", "<", "<=", ">", ">=":
+		p.next()
+		r, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return compare{op: t.text, l: l, r: r}, nil
+	case "=~", "!~":
+		p.next()
+		r, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		m := match{negate: t.text == "!~", x: l, pattern: r}
+		if lit, ok := r.(literal); ok {
+			if m.re, err = regexp.Compile(toString(lit.v)); err != nil {
+				return nil, fmt.Errorf("at %d: invalid regex: %w", t.pos, err)
+			}
+		}
+		return m, nil
+	}
+	return l, nil
+}
+
+func (p *parser) parseUnary() (node, error) {
+	if t := p.peek(); t.kind == tokOp && t.text == "!" {
+		p.next()
+		x, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return not{x: x}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *parser) parsePrimary() (node, error) {
+	t := p.next()
+	switch t.kind {
+	case tokString:
+		return literal{t.text}, nil
+	case tokNumber:
+		f, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("at %d: invalid number %q", t.pos, t.text)
+		}
+		return literal{f}, nil
+	case tokLParen:
+		x, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if t := p.next(); t.kind != tokRParen {
+			return nil, fmt.Errorf("at %d: expected ')'", t.pos)
+		}
+		return x, nil
+	case tokIdent:
+		name := strings.ToLower(t.text)
+		switch name {
+		case "true":
+			return literal{true}, nil
+		case "false":
+			return literal{false}, nil
+		}
+		if p.peek().kind != tokLParen {
+			return field{name: name}, nil
+		}
+		return p.parseCall(t, name)
+	case tokEOF:
+		return nil, fmt.Errorf("unexpected end of expression")
+	default:
+		return nil, fmt.Errorf("at %d: unexpected %q", t.pos, t.text)
+	}
+}
+
+func (p *parser) parseCall(t token, name string) (node, error) {
+	fn, ok := functions[name]
+	if !ok {
+		return nil, fmt.Errorf("at %d: unknown function %s", t.pos, name)
+	}
+	p.next() // (
+	var args []node
+	if p.peek().kind != tokRParen {
+		for {
+			arg, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, arg)
+			if p.peek().kind != tokComma {
+				break
+			}
+			p.next()
+		}
+	}
+	if t := p.next(); t.kind != tokRParen {
+		return nil, fmt.Errorf("at %d: expected ')'", t.pos)
+	}
+	if len(args) < fn.minArgs || (fn.maxArgs >= 0 && len(args) > fn.maxArgs) {
+		return nil, fmt.Errorf("at %d: %s takes %s", t.pos, name, fn.arity())
+	}
+	if fn.checkArg != nil {
+		for _, arg := range args {
+			if lit, ok := arg.(literal); ok {
+				if err := fn.checkArg(lit.v); err != nil {
+					return nil, fmt.Errorf("at %d: %s: %w", t.pos, name, err)
+				}
+			}
+		}
+	}
+	return call{fn: fn, args: args}, nil
+}
@@ -0,0 +1,194 @@
+package expr
+
+import (
+	"strings"
+	"testing"
+)
+
+var qso = map[string]string{
+	"call":             "K1ABC",
+	"band":             "2m",
+	"mode":             "FM",
+	"freq":             "145.5",
+	"prop_mode":        "SAT",
+	"station_callsign": "N0CALL/P",
+	"dxcc":             "291",
+	"qso_date":         "20240601",
+	"rst_sent":         " 59 ",
+	"pattern":          "(",
+}
+
+func TestEval(t *testing.T) {
+	tests := []struct {
+		src  string
+		want bool
+	}{
+		// 字段和比较
+		{`band == "2m"`, true},
+		{`BAND == "2M"`, true},
+		{`band != "2m"`, false},
+		{`call == "k1abc"`, true},
+		{`missing == ""`, true},
+		{`missing`, false},
+		{`call`, true},
+		{`rst_sent == 59`, true},
+		{`freq > 144`, true},
+		{`freq >= 145.5 && freq <= 145.5`, true},
+		{`freq < 100`, false},
+		{`"10" < "9"`, false},
+		{`"abc" < "abd"`, true},
+		{`call < 5`, false},
+
+		// 逻辑运算和优先级
+		{`band == "2m" && prop_mode == "SAT"`, true},
+		{`band == "20m" || mode == "FM"`, true},
+		{`band == "20m" || mode == "CW" && prop_mode == "SAT"`, false},
+		{`(band == "20m" || mode == "FM") && prop_mode == "SAT"`, true},
+		{`!(band == "2m")`, false},
+		{`!missing`, true},
+		{`!!call`, true},
+
+		// 布尔值和数字字面量
+		{`true`, true},
+		{`false || true`, true},
+		{`0`, false},
+		{`1.5`, true},
+		{`(band == "2m") == true`, true},
+		{`false != (mode == "CW")`, false},
+
+		// 正则
+		{`station_callsign =~ "/P$"`, true},
+		{`station_callsign !~ "/P$"`, false},
+		{`call =~ '^K\d'`, true},
+		{`call =~ "^K\\d"`, true},
+		{`call =~ band`, false},
+
+		// 内置函数
+		{`dxcc(291, 110)`, true},
+		{`dxcc(110)`, false},
+		{`dxcc("291")`, true},
+		{`freq_to_band(freq) == "2m"`, true},
+		{`freq_to_band(14.074) == "20m"`, true},
+		{`freq_to_band(missing) == ""`, true},
+		{`after("2024-06-01")`, true},
+		{`after("20240602")`, false},
+		{`before("2024-06-02")`, true},
+		{`before("2024-06-01")`, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.src, func(t *testing.T) {
+			p, err := Compile(tt.src)
+			if err != nil {
+				t.Fatalf("Compile(%q) error = %v", tt.src, err)
+			}
+			got, err := p.Eval(qso)
+			if err != nil {
+				t.Fatalf("Eval() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Eval() = %v, want %v", got, tt.want)
+			}
+			if p.String() != tt.src {
+				t.Errorf("String() = %q, want %q", p.String(), tt.src)
+			}
+		})
+	}
+}
+
+func TestEvalShortCircuit(t *testing.T) {
+	// 右边在求值时会出错，短路时不应被求值
+	for _, src := range []string{
+		`false && after(call)`,
+		`true || after(call)`,
+	} {
+		p, err := Compile(src)
+		if err != nil {
+			t.Fatalf("Compile(%q) error = %v", src, err)
+		}
+		if _, err := p.Eval(qso); err != nil {
+			t.Errorf("Eval(%q) error = %v, want short circuit", src, err)
+		}
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{``, "unexpected end of expression"},
+		{`band ==`, "unexpected end of expression"},
+		{`band == "2m" mode`, `at 13: unexpected "mode"`},
+		{`(band == "2m"`, "expected ')'"},
+		{`band = "2m"`, "unexpected character"},
+		{`band == "2m`, "unterminated string"},
+		{`call =~ "("`, "invalid regex"},
+		{`nope(1)`, "unknown function nope"},
+		{`after()`, "after takes 1 argument(s)"},
+		{`before(1, 2)`, "before takes 1 argument(s)"},
+		{`dxcc()`, "dxcc takes at least 1 argument(s)"},
+		{`after("yesterday")`, `after: invalid date "yesterday"`},
+		{`band == "2m" && before("2024-13-01")`, `before: invalid date "2024-13-01"`},
+		{`dxcc(291, "abc")`, `dxcc: invalid DXCC entity code "abc"`},
+		{`band == "\q"`, "invalid string"},
+		{`1.2.3`, "invalid number"},
+		{`,`, "unexpected \",\""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.src, func(t *testing.T) {
+			_, err := Compile(tt.src)
+			if err == nil {
+				t.Fatalf("Compile(%q) expected an error", tt.src)
+			}
+			if !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Compile(%q) error = %q, want it to contain %q", tt.src, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestEvalErrors(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{`true < false`, "operator < cannot be used with booleans"},
+		{`1 > (band == "2m")`, "operator > cannot be used with booleans"},
+		{`after(call)`, `after: invalid date "K1ABC"`},
+		{`dxcc(110, call)`, `dxcc: invalid DXCC entity code "K1ABC"`},
+		{`call =~ pattern`, "invalid regex"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.src, func(t *testing.T) {
+			p, err := Compile(tt.src)
+			if err != nil {
+				t.Fatalf("Compile(%q) error = %v", tt.src, err)
+			}
+			_, err = p.Eval(qso)
+			if err == nil {
+				t.Fatalf("Eval(%q) expected an error", tt.src)
+			}
+			if !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Eval(%q) error = %q, want it to contain %q", tt.src, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestLex(t *testing.T) {
+	tokens, err := lex(`a_1 >= 14.5 && f("x\"y", 'a\b') || !b`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, tok := range tokens {
+		got = append(got, tok.text)
+	}
+	want := []string{"a_1", ">=", "14.5", "&&", "f", "(", `x"y`, ",", `a\b`, ")", "||", "!", "b", ""}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("lex() = %q, want %q", got, want)
+	}
+	if last := tokens[len(tokens)-1]; last.kind != tokEOF {
+		t.Errorf("last token kind = %v, want tokEOF", last.kind)
+	}
+}
@@ -0,0 +1,121 @@
+package expr
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"git.esd.cc/imlonghao/adif2cloud/pkg/adif"
+)
+
+// function 是表达式中可以调用的内置函数，maxArgs 为 -1 表示参数个数不限。
+// checkArg 不为 nil 时在编译时检查字面量参数，避免写错的常量到求值时才报错
+type function struct {
+	name             string
+	minArgs, maxArgs int
+	call             func(fields map[string]string, args []value) (value, error)
+	checkArg         func(v value) error
+}
+
+func (f *function) arity() string {
+	switch {
+	case f.maxArgs < 0:
+		return fmt.Sprintf("at least %d argument(s)", f.minArgs)
+	case f.minArgs == f.maxArgs:
+		return fmt.Sprintf("%d argument(s)", f.minArgs)
+	default:
+		return fmt.Sprintf("%d to %d arguments", f.minArgs, f.maxArgs)
+	}
+}
+
+var functions = map[string]*function{}
+
+func init() {
+	for _, f := range []*function{
+		// freq_to_band(freq) 返回频率（MHz）所在的波段，例如 freq_to_band(freq) == "2m"
+		{name: "freq_to_band", minArgs: 1, maxArgs: 1, call: freqToBand},
+		// dxcc(code...) 判断记录中 DXCC 字段的实体编号是否为其中之一，不会根据呼号查询实体，
+		// 没有 DXCC 字段的记录总是 false
+		{name: "dxcc", minArgs: 1, maxArgs: -1, call: dxcc, checkArg: checkDXCC},
+		// after(date) 判断 QSO 是否在该日期当天或之后，date 为 YYYY-MM-DD 或 YYYYMMDD
+		{name: "after", minArgs: 1, maxArgs: 1, call: after, checkArg: checkDate},
+		// before(date) 判断 QSO 是否在该日期之前
+		{name: "before", minArgs: 1, maxArgs: 1, call: before, checkArg: checkDate},
+	} {
+		functions[f.name] = f
+	}
+}
+
+func freqToBand(_ map[string]string, args []value) (value, error) {
+	mhz, ok := toNumber(args[0])
+	if !ok {
+		return "", nil
+	}
+	return adif.FreqToBand(mhz), nil
+}
+
+func dxcc(fields map[string]string, args []value) (value, error) {
+	entity, err := strconv.Atoi(strings.TrimSpace(fields["dxcc"]))
+	if err != nil {
+		return false, nil
+	}
+	for _, arg := range args {
+		code, err := argDXCC(arg)
+		if err != nil {
+			return nil, err
+		}
+		if code == entity {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// argDXCC 把参数转换为 DXCC 实体编号
+func argDXCC(v value) (int, error) {
+	code, ok := toNumber(v)
+	if !ok {
+		return 0, fmt.Errorf("invalid DXCC entity code %q", toString(v))
+	}
+	return int(code), nil
+}
+
+func checkDXCC(v value) error {
+	_, err := argDXCC(v)
+	return err
+}
+
+func after(fields map[string]string, args []value) (value, error) {
+	date, err := argDate(args[0])
+	if err != nil {
+		return nil, err
+	}
+	qsoDate := strings.TrimSpace(fields["qso_date"])
+	return qsoDate != "" && qsoDate >= date, nil
+}
+
+func before(fields map[string]string, args []value) (value, error) {
+	date, err := argDate(args[0])
+	if err != nil {
+		return nil, err
+	}
+	qsoDate := strings.TrimSpace(fields["qso_date"])
+	return qsoDate != "" && qsoDate < date, nil
+}
+
+// argDate 把日期参数转换为 ADIF 的 YYYYMMDD 格式
+func argDate(v value) (string, error) {
+	s := toString(v)
+	for _, layout := range []string{"2006-01-02", "20060102"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.Format("20060102"), nil
+		}
+	}
+	return "", fmt.Errorf("invalid date %q, expected YYYY-MM-DD", s)
+}
+
+func checkDate(v value) error {
+	_, err := argDate(v)
+	return err
+}
@@ -0,0 +1,115 @@
+package expr
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokString
+	tokNumber
+	tokOp
+	tokLParen
+	tokRParen
+	tokComma
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+// operators 按长度从长到短排列，保证 "==" 不会被识别成 "="
+var operators = []string{"==", "!=", "=~", "!~", "<=", ">=", "&&", "||", "<", ">", "!"}
+
+// lex 把表达式切分成 token，最后一个 token 总是 tokEOF
+func lex(src string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '(':
+			tokens = append(tokens, token{tokLParen, "(", i})
+			i++
+		case c == ')':
+			tokens = append(tokens, token{tokRParen, ")", i})
+			i++
+		case c == ',':
+			tokens = append(tokens, token{tokComma, ",", i})
+			i++
+		case c == '"' || c == '\'':
+			text, n, err := lexString(src[i:])
+			if err != nil {
+				return nil, fmt.Errorf("at %d: %w", i, err)
+			}
+			tokens = append(tokens, token{tokString, text, i})
+			i += n
+		case isDigit(c) || (c == '.' && i+1 < len(src) && isDigit(src[i+1])):
+			start := i
+			for i < len(src) && (isDigit(src[i]) || src[i] == '.') {
+				i++
+			}
+			tokens = append(tokens, token{tokNumber, src[start:i], start})
+		case isIdentStart(c):
+			start := i
+			for i < len(src) && (isIdentStart(src[i]) || isDigit(src[i])) {
+				i++
+			}
+			tokens = append(tokens, token{tokIdent, src[start:i], start})
+		default:
+			op := ""
+			for _, candidate := range operators {
+				if strings.HasPrefix(src[i:], candidate) {
+					op = candidate
+					break
+				}
+			}
+			if op == "" {
+				return nil, fmt.Errorf("at %d: unexpected character %q", i, c)
+			}
+			tokens = append(tokens, token{tokOp, op, i})
+			i += len(op)
+		}
+	}
+	return append(tokens, token{tokEOF, "", len(src)}), nil
+}
+
+// lexString 读取以引号开头的字符串字面量，返回解码后的内容和消耗的字节数。
+// 双引号字符串支持 Go 的转义，单引号字符串按原样读取，便于书写正则表达式
+func lexString(src string) (string, int, error) {
+	quote := src[0]
+	for i := 1; i < len(src); i++ {
+		switch src[i] {
+		case '\\':
+			if quote == '"' {
+				i++
+			}
+		case quote:
+			if quote == '\'' {
+				return src[1:i], i + 1, nil
+			}
+			text, err := strconv.Unquote(src[:i+1])
+			if err != nil {
+				return "", 0, fmt.Errorf("invalid string %s: %w", src[:i+1], err)
+			}
+			return text, i + 1, nil
+		}
+	}
+	return "", 0, fmt.Errorf("unterminated string")
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
@@ -0,0 +1,178 @@
+package filter
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"git.esd.cc/imlonghao/adif2cloud/pkg/expr"
+)
+
+// Rule 是针对一个 ADIF 字段的条件，设置了的条件必须全部满足规则才算匹配。
+// equals 和 in 不区分大小写，from 和 to 是日期字段（如 qso_date）的闭区间
+type Rule struct {
+	Field  string   `mapstructure:"field"`
+	Equals string   `mapstructure:"equals"`
+	In     []string `mapstructure:"in"`
+	Regex  string   `mapstructure:"regex"`
+	From   string   `mapstructure:"from"`
+	To     string   `mapstructure:"to"`
+}
+
+// Config 是目标的 filter 配置。有 include 规则时 QSO 至少要匹配其中一条，
+// 匹配任意一条 exclude 规则的 QSO 会被跳过，When 不为空时表达式的结果也必须为真
+type Config struct {
+	Include []Rule `mapstructure:"include"`
+	Exclude []Rule `mapstructure:"exclude"`
+	// When 来自目标的 when 配置，语法见 expr 包
+	When string `mapstructure:"-"`
+}
+
+// Filter 是编译后的过滤规则，nil 表示不过滤
+type Filter struct {
+	include []*rule
+	exclude []*rule
+	when    *expr.Program
+}
+
+type rule struct {
+	Rule
+	in       []string
+	regex    *regexp.Regexp
+	from, to string
+}
+
+// Compile 检查并编译过滤规则，没有任何规则时返回 nil
+func Compile(cfg Config) (*Filter, error) {
+	if len(cfg.Include) == 0 && len(cfg.Exclude) == 0 && strings.TrimSpace(cfg.When) == "" {
+		return nil, nil
+	}
+	var f Filter
+	var errs []error
+	for i, r := range cfg.Include {
+		compiled, err := compile(r)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("include[%d]: %w", i, err))
+			continue
+		}
+		f.include = append(f.include, compiled)
+	}
+	for i, r := range cfg.Exclude {
+		compiled, err := compile(r)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("exclude[%d]: %w", i, err))
+			continue
+		}
+		f.exclude = append(f.exclude, compiled)
+	}
+	if strings.TrimSpace(cfg.When) != "" {
+		program, err := expr.Compile(cfg.When)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("when: %w", err))
+		}
+		f.when = program
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	return &f, nil
+}
+
+func compile(r Rule) (*rule, error) {
+	r.Field = strings.ToLower(strings.TrimSpace(r.Field))
+	if r.Field == "" {
+		return nil, fmt.Errorf("missing required field \"field\"")
+	}
+	if r.Equals == "" && len(r.In) == 0 && r.Regex == "" && r.From == "" && r.To == "" {
+		return nil, fmt.Errorf("rule for %q has no condition, set equals, in, regex, from or to", r.Field)
+	}
+	compiled := &rule{Rule: r}
+	for _, v := range r.In {
+		compiled.in = append(compiled.in, strings.ToUpper(strings.TrimSpace(v)))
+	}
+	if r.Regex != "" {
+		re, err := regexp.Compile(r.Regex)
+		if err != nil {
+			return nil, fmt.Errorf("invalid regex for %q: %w", r.Field, err)
+		}
+		compiled.regex = re
+	}
+	var err error
+	if compiled.from, err = normalizeDate(r.From); err != nil {
+		return nil, fmt.Errorf("invalid from for %q: %w", r.Field, err)
+	}
+	if compiled.to, err = normalizeDate(r.To); err != nil {
+		return nil, fmt.Errorf("invalid to for %q: %w", r.Field, err)
+	}
+	return compiled, nil
+}
+
+// normalizeDate 把 2006-01-02 或 20060102 格式的日期转换为 ADIF 的 YYYYMMDD 格式
+func normalizeDate(s string) (string, error) {
+	if s == "" {
+		return "", nil
+	}
+	for _, layout := range []string{"2006-01-02", "20060102"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.Format("20060102"), nil
+		}
+	}
+	return "", fmt.Errorf("invalid date %q, expected YYYY-MM-DD", s)
+}
+
+func (r *rule) match(fields map[string]string) bool {
+	value := strings.TrimSpace(fields[r.Field])
+	if r.Equals != "" && !strings.EqualFold(value, strings.TrimSpace(r.Equals)) {
+		return false
+	}
+	if len(r.in) > 0 && !slices.Contains(r.in, strings.ToUpper(value)) {
+		return false
+	}
+	if r.regex != nil && !r.regex.MatchString(value) {
+		return false
+	}
+	if r.from != "" && (value == "" || value < r.from) {
+		return false
+	}
+	if r.to != "" && (value == "" || value > r.to) {
+		return false
+	}
+	return true
+}
+
+// Match 判断 adif.Parse 解析出的记录是否应该发送，不发送时返回原因
+func (f *Filter) Match(fields map[string]string) (bool, string) {
+	if f == nil {
+		return true, ""
+	}
+	if len(f.include) > 0 {
+		included := false
+		for _, r := range f.include {
+			if r.match(fields) {
+				included = true
+				break
+			}
+		}
+		if !included {
+			return false, "no include rule matched"
+		}
+	}
+	for i, r := range f.exclude {
+		if r.match(fields) {
+			return false, fmt.Sprintf("matched exclude[%d] on %q", i, r.Field)
+		}
+	}
+	if f.when != nil {
+		ok, err := f.when.Eval(fields)
+		if err != nil {
+			return false, fmt.Sprintf("when expression failed: %s", err)
+		}
+		if !ok {
+			return false, fmt.Sprintf("when expression is false: %s", f.when)
+		}
+	}
+	return true, ""
+}
@@ -0,0 +1,72 @@
+package filter
+
+import (
+	"strings"
+	"testing"
+
+	"git.esd.cc/imlonghao/adif2cloud/pkg/adif"
+)
+
+func TestMatch(t *testing.T) {
+	const record = "<call:5>BA1AA<band:3>20m<mode:3>FT8<qso_date:8>20240615<station_callsign:6>BG2XYZ<eor>"
+	tests := []struct {
+		name       string
+		cfg        Config
+		want       bool
+		wantReason string
+	}{
+		{"no rules", Config{}, true, ""},
+		{"include equals ignores case", Config{Include: []Rule{{Field: "BAND", Equals: "20M"}}}, true, ""},
+		{"include does not match", Config{Include: []Rule{{Field: "band", Equals: "40m"}}}, false, "no include rule matched"},
+		{"any include rule matches", Config{Include: []Rule{{Field: "band", Equals: "40m"}, {Field: "mode", In: []string{"cw", "ft8"}}}}, true, ""},
+		{"all conditions of a rule must match", Config{Include: []Rule{{Field: "band", Equals: "20m", Regex: "^40"}}}, false, "no include rule matched"},
+		{"include regex", Config{Include: []Rule{{Field: "call", Regex: "^BA"}}}, true, ""},
+		{"date range", Config{Include: []Rule{{Field: "qso_date", From: "2024-06-01", To: "20240630"}}}, true, ""},
+		{"after date range", Config{Include: []Rule{{Field: "qso_date", To: "2024-06-14"}}}, false, "no include rule matched"},
+		{"date range on missing field", Config{Include: []Rule{{Field: "qso_date_off", From: "2024-01-01"}}}, false, "no include rule matched"},
+		{"exclude", Config{Exclude: []Rule{{Field: "mode", Equals: "ft8"}}}, false, `matched exclude[0] on "mode"`},
+		{"exclude does not match", Config{Exclude: []Rule{{Field: "mode", Equals: "cw"}}}, true, ""},
+		{"exclude wins over include", Config{
+			Include: []Rule{{Field: "band", Equals: "20m"}},
+			Exclude: []Rule{{Field: "call", In: []string{"BG1AA"}}, {Field: "station_callsign", Regex: "XYZ$"}},
+		}, false, `matched exclude[1] on "station_callsign"`},
+		{"when is true", Config{When: `band == "20m" && mode == "FT8"`}, true, ""},
+		{"when is false", Config{When: `band == "40m"`}, false, `when expression is false: band == "40m"`},
+		{"when after include", Config{Include: []Rule{{Field: "band", Equals: "20m"}}, When: `call =~ "^BG"`}, false, `when expression is false: call =~ "^BG"`},
+	}
+	fields := adif.Parse(record)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := Compile(tt.cfg)
+			if err != nil {
+				t.Fatalf("Compile() error = %v", err)
+			}
+			got, reason := f.Match(fields)
+			if got != tt.want || reason != tt.wantReason {
+				t.Errorf("Match() = %v, %q, want %v, %q", got, reason, tt.want, tt.wantReason)
+			}
+		})
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  Config
+		want string
+	}{
+		{"missing field", Config{Include: []Rule{{Equals: "20m"}}}, `include[0]: missing required field "field"`},
+		{"no condition", Config{Exclude: []Rule{{Field: "band"}}}, `exclude[0]: rule for "band" has no condition`},
+		{"invalid regex", Config{Include: []Rule{{Field: "call", Regex: "("}}}, `include[0]: invalid regex for "call"`},
+		{"invalid date", Config{Include: []Rule{{Field: "qso_date", From: "June"}}}, `include[0]: invalid from for "qso_date"`},
+		{"invalid when", Config{When: `band ==`}, "when: unexpected end of expression"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Compile(tt.cfg)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Compile() error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
@@ -1,12 +1,16 @@
 package git
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"log/slog"
 	"os"
 	"time"
 
+	"git.esd.cc/imlonghao/adif2cloud/pkg/adif"
+	"git.esd.cc/imlonghao/adif2cloud/pkg/provider"
+
 	"github.com/go-git/go-billy/v5/memfs"
 	"github.com/go-git/go-git/v5"
 	"github.com/go-git/go-git/v5/config"
@@ -19,15 +23,23 @@ import (
 )
 
 type GitConfig struct {
-	RepoURL              string
-	Branch               string
-	FileName             string
-	CommitAuthor         string
-	CommitEmail          string
-	AuthUsername         string
-	AuthPassword         string
-	AuthSSHKey           string
-	AuthSSHKeyPassphrase string
+	RepoURL              string `mapstructure:"repo_url" required:"true"`
+	Branch               string `mapstructure:"branch"`
+	FileName             string `mapstructure:"file_name"`
+	CommitAuthor         string `mapstructure:"commit_author"`
+	CommitEmail          string `mapstructure:"commit_email"`
+	AuthUsername         string `mapstructure:"auth_username"`
+	AuthPassword         string `mapstructure:"auth_password"`
+	AuthSSHKey           string `mapstructure:"auth_ssh_key"`
+	AuthSSHKeyPassphrase string `mapstructure:"auth_ssh_key_passphrase"`
+	// Format 是提交的日志格式，adi（默认）或 adx
+	Format string `mapstructure:"format"`
+}
+
+func init() {
+	provider.Register("git", func(cfg GitConfig) (provider.Provider, error) {
+		return NewGitProvider(cfg)
+	})
 }
 
 type GitProvider struct {
@@ -38,6 +50,12 @@ type GitProvider struct {
 
 func NewGitProvider(config GitConfig) (*GitProvider, error) {
 	slog.Debug("Creating Git provider", "repo_url", config.RepoURL, "branch", config.Branch)
+	format, err := adif.ParseFormat(config.Format)
+	if err != nil {
+		return nil, err
+	}
+	config.Format = format
+
 	// 配置认证方式
 	var auth transport.AuthMethod
 	if config.AuthSSHKey != "" {
@@ -122,7 +140,12 @@ func (p *GitProvider) GetName() string {
 	return fmt.Sprintf("Git->%s", p.config.RepoURL)
 }
 
-func (p *GitProvider) GetSize() (int64, error) {
+// UploadsFile 表示 Git 提交的是整个源文件
+func (p *GitProvider) UploadsFile() bool {
+	return true
+}
+
+func (p *GitProvider) GetSize(_ context.Context) (int64, error) {
 	worktree, err := p.repo.Worktree()
 	if err != nil {
 		return 0, fmt.Errorf("failed to get worktree: %w", err)
@@ -139,7 +162,7 @@ func (p *GitProvider) GetSize() (int64, error) {
 	return fileInfo.Size(), nil
 }
 
-func (p *GitProvider) Download(w io.Writer) error {
+func (p *GitProvider) Download(_ context.Context, w io.Writer) error {
 	worktree, err := p.repo.Worktree()
 	if err != nil {
 		return fmt.Errorf("failed to get worktree: %w", err)
@@ -155,25 +178,28 @@ func (p *GitProvider) Download(w io.Writer) error {
 	return err
 }
 
-func (p *GitProvider) Upload(sourceFilePath string, _ string) error {
+func (p *GitProvider) Upload(ctx context.Context, sourceFilePath string, _ string) error {
 	worktree, err := p.repo.Worktree()
 	if err != nil {
 		return fmt.Errorf("failed to get worktree: %w", err)
 	}
 
-	err = worktree.Pull(&git.PullOptions{
+	err = worktree.PullContext(ctx, &git.PullOptions{
 		Auth: p.auth,
 	})
 	if err != nil {
 		return fmt.Errorf("failed to pull: %w", err)
 	}
 
-	// 读取源文件
-	sourceFile, err := os.Open(sourceFilePath)
+	// 读取源文件并转换为配置的格式
+	content, err := os.ReadFile(sourceFilePath)
 	if err != nil {
-		return fmt.Errorf("failed to open source file: %w", err)
+		return fmt.Errorf("failed to read source file: %w", err)
+	}
+	content, err = adif.Convert(content, p.config.Format)
+	if err != nil {
+		return fmt.Errorf("failed to convert file to %s: %w", p.config.Format, err)
 	}
-	defer sourceFile.Close()
 
 	// 写到仓库
 	repoFile, err := worktree.Filesystem.OpenFile(p.config.FileName, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
@@ -183,7 +209,9 @@ func (p *GitProvider) Upload(sourceFilePath string, _ string) error {
 	defer repoFile.Close()
 
 	// 写文件
-	io.Copy(repoFile, sourceFile)
+	if _, err := repoFile.Write(content); err != nil {
+		return fmt.Errorf("failed to write file: %w", err)
+	}
 
 	// 添加文件到暂存区
 	if _, err := worktree.Add(p.config.FileName); err != nil {
@@ -204,7 +232,7 @@ func (p *GitProvider) Upload(sourceFilePath string, _ string) error {
 	}
 
 	// 推送到远程仓库
-	if err := p.repo.Push(&git.PushOptions{
+	if err := p.repo.PushContext(ctx, &git.PushOptions{
 		Auth: p.auth,
 		RefSpecs: []config.RefSpec{
 			config.RefSpec(fmt.Sprintf("+%s:%s", plumbing.NewBranchReferenceName(p.config.Branch), plumbing.NewBranchReferenceName(p.config.Branch))),
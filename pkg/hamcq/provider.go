@@ -2,6 +2,7 @@ package hamcq
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -9,18 +10,26 @@ import (
 	"net/http"
 
 	"git.esd.cc/imlonghao/adif2cloud/internal/consts"
+	"git.esd.cc/imlonghao/adif2cloud/pkg/provider"
 
 	"github.com/projectdiscovery/retryablehttp-go"
 )
 
 // HamCQConfig 定义了 HamCQ 配置
 type HamCQConfig struct {
-	Key string `mapstructure:"key"`
+	Key string `mapstructure:"key" required:"true"`
+}
+
+func init() {
+	provider.Register("hamcq", func(cfg HamCQConfig) (provider.Provider, error) {
+		return NewHamCQProvider(cfg), nil
+	})
 }
 
 // HamCQProvider 实现了 Provider 接口，用于 HamCQ 服务
 type HamCQProvider struct {
 	config HamCQConfig
+	client *retryablehttp.Client
 }
 
 type QSORequest struct {
@@ -34,23 +43,24 @@ func NewHamCQProvider(cfg HamCQConfig) *HamCQProvider {
 	slog.Debug("Creating HamCQ provider", "key", cfg.Key)
 	return &HamCQProvider{
 		config: cfg,
+		client: retryablehttp.NewClient(retryablehttp.DefaultOptionsSingle),
 	}
 }
 
 // GetSize 获取 HamCQ 上 ADIF 文件的大小
-func (p *HamCQProvider) GetSize() (int64, error) {
+func (p *HamCQProvider) GetSize(_ context.Context) (int64, error) {
 	// HamCQ 不直接提供文件大小，返回 0
 	return 0, nil
 }
 
 // Download 从 HamCQ 下载 ADIF 文件
-func (p *HamCQProvider) Download(w io.Writer) error {
+func (p *HamCQProvider) Download(_ context.Context, w io.Writer) error {
 	// HamCQ 不直接提供下载功能，返回错误
 	return fmt.Errorf("club log does not support direct file download")
 }
 
 // Upload 上传 QSO 记录到 HamCQ
-func (p *HamCQProvider) Upload(_ string, line string) error {
+func (p *HamCQProvider) Upload(ctx context.Context, _ string, line string) error {
 	qsoReq := QSORequest{
 		Key:  p.config.Key,
 		ADIF: line,
@@ -62,14 +72,13 @@ func (p *HamCQProvider) Upload(_ string, line string) error {
 		return fmt.Errorf("failed to marshal request: %w", err)
 	}
 
-	client := retryablehttp.NewClient(retryablehttp.DefaultOptionsSingle)
-	req, err := retryablehttp.NewRequest(http.MethodPost, "https://api.hamcq.cn/v1/logbook?from=gridtracker", bytes.NewBuffer(jsonData))
+	req, err := retryablehttp.NewRequestWithContext(ctx, http.MethodPost, "https://api.hamcq.cn/v1/logbook?from=gridtracker", bytes.NewBuffer(jsonData))
 	if err != nil {
 		return fmt.Errorf("failed to create request: %w", err)
 	}
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("User-Agent", fmt.Sprintf("adif2cloud/%s (+https://git.esd.cc/imlonghao/adif2cloud)", consts.Version))
-	resp, err := client.Do(req)
+	resp, err := p.client.Do(req)
 	if err != nil {
 		return fmt.Errorf("failed to send request: %w", err)
 	}
@@ -83,7 +92,7 @@ func (p *HamCQProvider) Upload(_ string, line string) error {
 
 	// 检查状态码
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("unexpected status code: %d, body: %s", resp.StatusCode, string(body))
+		return provider.StatusError(resp.StatusCode, string(body))
 	}
 
 	return nil
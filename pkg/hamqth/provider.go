@@ -2,6 +2,7 @@ package hamqth
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"log/slog"
@@ -9,20 +10,28 @@ import (
 	"net/url"
 
 	"git.esd.cc/imlonghao/adif2cloud/internal/consts"
+	"git.esd.cc/imlonghao/adif2cloud/pkg/provider"
 
 	"github.com/projectdiscovery/retryablehttp-go"
 )
 
 // HamQTHConfig 定义了 HamQTH 配置
 type HamQTHConfig struct {
-	Username string `mapstructure:"username"`
-	Password string `mapstructure:"password"`
+	Username string `mapstructure:"username" required:"true"`
+	Password string `mapstructure:"password" required:"true"`
 	Callsign string `mapstructure:"callsign"`
 }
 
+func init() {
+	provider.Register("hamqth", func(cfg HamQTHConfig) (provider.Provider, error) {
+		return NewHamQTHProvider(cfg), nil
+	})
+}
+
 // HamQTHProvider 实现了 Provider 接口，用于 HamQTH 服务
 type HamQTHProvider struct {
 	config HamQTHConfig
+	client *retryablehttp.Client
 }
 
 // NewHamQTHProvider 创建一个新的 HamQTHProvider 实例
@@ -30,23 +39,24 @@ func NewHamQTHProvider(cfg HamQTHConfig) *HamQTHProvider {
 	slog.Debug("Creating HamQTH provider", "username", cfg.Username, "callsign", cfg.Callsign)
 	return &HamQTHProvider{
 		config: cfg,
+		client: retryablehttp.NewClient(retryablehttp.DefaultOptionsSingle),
 	}
 }
 
 // GetSize 获取 HamQTH 上 ADIF 文件的大小
-func (p *HamQTHProvider) GetSize() (int64, error) {
+func (p *HamQTHProvider) GetSize(_ context.Context) (int64, error) {
 	// HamQTH 不直接提供文件大小，返回 0
 	return 0, nil
 }
 
 // Download 从 HamQTH 下载 ADIF 文件
-func (p *HamQTHProvider) Download(w io.Writer) error {
+func (p *HamQTHProvider) Download(_ context.Context, w io.Writer) error {
 	// HamQTH 不直接提供下载功能，返回错误
 	return fmt.Errorf("hamqth does not support direct file download")
 }
 
 // Upload 上传 QSO 记录到 HamQTH
-func (p *HamQTHProvider) Upload(_ string, line string) error {
+func (p *HamQTHProvider) Upload(ctx context.Context, _ string, line string) error {
 	params := url.Values{}
 	params.Set("u", p.config.Username)
 	params.Set("p", p.config.Password)
@@ -57,15 +67,14 @@ func (p *HamQTHProvider) Upload(_ string, line string) error {
 	params.Set("prg", "adif2cloud")
 	params.Set("cmd", "insert")
 
-	client := retryablehttp.NewClient(retryablehttp.DefaultOptionsSingle)
-	req, err := retryablehttp.NewRequest(http.MethodPost, "https://www.hamqth.com/qso_realtime.php", bytes.NewBufferString(params.Encode()))
+	req, err := retryablehttp.NewRequestWithContext(ctx, http.MethodPost, "https://www.hamqth.com/qso_realtime.php", bytes.NewBufferString(params.Encode()))
 	if err != nil {
 		return fmt.Errorf("failed to create request: %w", err)
 	}
 	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 	req.Header.Set("User-Agent", fmt.Sprintf("adif2cloud/%s (+https://git.esd.cc/imlonghao/adif2cloud)", consts.Version))
 
-	resp, err := client.Do(req)
+	resp, err := p.client.Do(req)
 	if err != nil {
 		return fmt.Errorf("failed to send request: %w", err)
 	}
@@ -86,9 +95,9 @@ func (p *HamQTHProvider) Upload(_ string, line string) error {
 	case http.StatusInternalServerError:
 		return fmt.Errorf("server error: %s", string(body))
 	case http.StatusBadRequest:
-		return fmt.Errorf("qso rejected: %s", string(body))
+		return provider.Permanent(fmt.Errorf("qso rejected: %s", string(body)))
 	default:
-		return fmt.Errorf("unexpected status code: %d, body: %s", resp.StatusCode, string(body))
+		return provider.StatusError(resp.StatusCode, string(body))
 	}
 }
 
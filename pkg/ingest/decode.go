@@ -0,0 +1,99 @@
+package ingest
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"strconv"
+	"strings"
+
+	"git.esd.cc/imlonghao/adif2cloud/pkg/adif"
+)
+
+// decode 把请求体切分为 ADI 格式的记录。JSON 请求体是一个对象或对象数组，
+// 键为 ADIF 字段名；其他请求体按 ADX 或 ADI 解析
+func decode(contentType string, body []byte) ([]string, error) {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch {
+	case mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"):
+		return decodeJSON(body)
+	case mediaType == "application/xml" || mediaType == "text/xml" || adif.IsADX(string(body)):
+		log, err := adif.ParseADX(string(body))
+		if err != nil {
+			return nil, err
+		}
+		return log.Records, nil
+	default:
+		return adif.Split(string(body)), nil
+	}
+}
+
+func decodeJSON(body []byte) ([]string, error) {
+	body = bytes.TrimSpace(body)
+	var objects []map[string]any
+	if len(body) > 0 && body[0] == '[' {
+		if err := json.Unmarshal(body, &objects); err != nil {
+			return nil, fmt.Errorf("invalid JSON: %w", err)
+		}
+	} else {
+		var object map[string]any
+		if err := json.Unmarshal(body, &object); err != nil {
+			return nil, fmt.Errorf("invalid JSON: %w", err)
+		}
+		objects = []map[string]any{object}
+	}
+
+	records := make([]string, len(objects))
+	for i, object := range objects {
+		fields := make(map[string]string, len(object))
+		for name, value := range object {
+			s, err := jsonValue(value)
+			if err != nil {
+				return nil, fmt.Errorf("record %d: field %q: %w", i, name, err)
+			}
+			fields[strings.ToLower(strings.TrimSpace(name))] = s
+		}
+		record, err := adif.FormatRecord(fields)
+		if err != nil {
+			return nil, fmt.Errorf("record %d: %w", i, err)
+		}
+		records[i] = record
+	}
+	return records, nil
+}
+
+// jsonValue 把 JSON 中的字符串、数字和布尔值转换为 ADIF 的值
+func jsonValue(v any) (string, error) {
+	switch v := v.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case bool:
+		if v {
+			return "Y", nil
+		}
+		return "N", nil
+	default:
+		return "", errors.New("value must be a string, number or boolean")
+	}
+}
+
+// validate 检查记录是否包含确定 QSO 所需的字段，以及这些字段能否被正确解析
+func validate(fields map[string]string) error {
+	var missing []string
+	for _, name := range []string{"call", "qso_date", "time_on"} {
+		if strings.TrimSpace(fields[name]) == "" {
+			missing = append(missing, strings.ToUpper(name))
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("missing required field(s) %s", strings.Join(missing, ", "))
+	}
+	_, err := adif.QSOFromFields(fields)
+	return err
+}
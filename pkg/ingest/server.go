@@ -0,0 +1,205 @@
+package ingest
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"git.esd.cc/imlonghao/adif2cloud/pkg/adif"
+	"git.esd.cc/imlonghao/adif2cloud/pkg/source"
+)
+
+// maxBodySize 是单个请求体的大小上限
+const maxBodySize = 10 << 20
+
+// Config 定义了 HTTP 接收服务的配置
+type Config struct {
+	// Listen 是监听的地址，例如 127.0.0.1:8073
+	Listen string `mapstructure:"listen"`
+	// Token 是客户端需要在 Authorization: Bearer 中提供的令牌
+	Token string `mapstructure:"token"`
+}
+
+// Server 通过 POST /qso 接收 ADI、ADX 或 JSON 格式的 QSO，
+// 每条记录作为新增事件交给 submit，并在响应中返回每条记录的处理结果
+type Server struct {
+	listener net.Listener
+	server   *http.Server
+	token    string
+	submit   func(source.Event) Routing
+}
+
+// Routing 是一条记录交给各个目标的结果
+type Routing struct {
+	// Queued 是已写入上传队列的目标
+	Queued []string `json:"queued,omitempty"`
+	// Filtered 是没有接收这条记录的目标
+	Filtered []string `json:"filtered,omitempty"`
+	// Failed 是写入队列失败的目标及其错误
+	Failed map[string]string `json:"failed,omitempty"`
+}
+
+// Result 是一条记录的处理结果
+type Result struct {
+	Index    int    `json:"index"`
+	Identity string `json:"identity,omitempty"`
+	// Status 为 queued 表示至少写入了一个目标的上传队列，filtered 表示所有目标都没有接收，
+	// rejected 表示记录无效或没有写入任何队列，客户端只需要重新提交 rejected 的记录
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+	Routing
+}
+
+// Response 是 POST /qso 的响应
+type Response struct {
+	Queued   int      `json:"queued"`
+	Filtered int      `json:"filtered"`
+	Rejected int      `json:"rejected"`
+	Results  []Result `json:"results"`
+}
+
+// NewServer 创建 HTTP 接收服务并开始监听，submit 返回记录交给各个目标的结果
+func NewServer(cfg Config, submit func(source.Event) Routing) (*Server, error) {
+	slog.Info("Creating HTTP ingestion server", "listen", cfg.Listen)
+	if strings.TrimSpace(cfg.Token) == "" {
+		return nil, errors.New("a token is required")
+	}
+	listener, err := net.Listen("tcp", cfg.Listen)
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{
+		listener: listener,
+		token:    cfg.Token,
+		submit:   submit,
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/qso", s.handleQSO)
+	s.server = &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	return s, nil
+}
+
+func (s *Server) Start() error {
+	slog.Info("Starting HTTP ingestion server", "listen", s.listener.Addr().String())
+	go func() {
+		if err := s.server.Serve(s.listener); !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("HTTP ingestion server stopped", "error", err)
+		}
+	}()
+	return nil
+}
+
+// Close 停止接收新的请求，并等待正在处理的请求完成
+func (s *Server) Close() {
+	slog.Info("Closing HTTP ingestion server", "listen", s.listener.Addr().String())
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := s.server.Shutdown(ctx); err != nil {
+		slog.Warn("Failed to shut down HTTP ingestion server", "error", err)
+	}
+	s.listener.Close()
+}
+
+func (s *Server) handleQSO(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		httpError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	if !s.authorized(r) {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="adif2cloud"`)
+		httpError(w, http.StatusUnauthorized, "invalid or missing bearer token")
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBodySize))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			httpError(w, http.StatusRequestEntityTooLarge, "request body is too large")
+			return
+		}
+		httpError(w, http.StatusBadRequest, "failed to read request body")
+		return
+	}
+	records, err := decode(r.Header.Get("Content-Type"), body)
+	if err != nil {
+		httpError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if len(records) == 0 {
+		httpError(w, http.StatusBadRequest, "request body contains no records")
+		return
+	}
+
+	resp := Response{Results: make([]Result, len(records))}
+	for i, record := range records {
+		fields := adif.Parse(record)
+		result := Result{Index: i, Identity: adif.Identity(fields)}
+		if err := validate(fields); err != nil {
+			result.Status = "rejected"
+			result.Error = err.Error()
+		} else {
+			result.Routing = s.submit(source.Event{Kind: source.Added, Identity: result.Identity, Record: record})
+			result.Status = result.Routing.status()
+			if result.Status == "rejected" {
+				result.Error = "failed to queue for any target"
+			}
+		}
+		switch result.Status {
+		case "queued":
+			resp.Queued++
+		case "filtered":
+			resp.Filtered++
+		default:
+			resp.Rejected++
+		}
+		resp.Results[i] = result
+	}
+	slog.Info("Received QSOs over HTTP", "remote", r.RemoteAddr, "queued", resp.Queued, "filtered", resp.Filtered, "rejected", resp.Rejected)
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// status 返回记录的状态。只要有目标写入了队列就是 queued，
+// 否则重新提交会让已经写入的目标重复上传
+func (r Routing) status() string {
+	switch {
+	case len(r.Queued) > 0:
+		return "queued"
+	case len(r.Failed) > 0:
+		return "rejected"
+	default:
+		return "filtered"
+	}
+}
+
+// authorized 检查 Authorization 头中的 bearer 令牌
+func (s *Server) authorized(r *http.Request) bool {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(strings.TrimSpace(token)), []byte(s.token)) == 1
+}
+
+func httpError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.Debug("Failed to write HTTP response", "error", err)
+	}
+}
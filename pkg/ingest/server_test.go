@@ -0,0 +1,73 @@
+package ingest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"git.esd.cc/imlonghao/adif2cloud/pkg/source"
+)
+
+func TestHandleQSOStatus(t *testing.T) {
+	const record = "<call:5>BA1AA<qso_date:8>20240101<time_on:4>1200<eor>"
+	tests := []struct {
+		name    string
+		body    string
+		routing Routing
+		want    string
+		counts  [3]int // queued, filtered, rejected
+	}{
+		{"queued", record, Routing{Queued: []string{"qrz"}}, "queued", [3]int{1, 0, 0}},
+		{"filtered by every target", record, Routing{Filtered: []string{"qrz", "lotw"}}, "filtered", [3]int{0, 1, 0}},
+		{"no targets", record, Routing{}, "filtered", [3]int{0, 1, 0}},
+		{"partial failure", record, Routing{Queued: []string{"qrz"}, Failed: map[string]string{"lotw": "disk full"}}, "queued", [3]int{1, 0, 0}},
+		{"all failed", record, Routing{Failed: map[string]string{"qrz": "disk full"}}, "rejected", [3]int{0, 0, 1}},
+		{"invalid", "<call:5>BA1AA<eor>", Routing{Queued: []string{"qrz"}}, "rejected", [3]int{0, 0, 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			submitted := 0
+			s := &Server{token: "secret", submit: func(source.Event) Routing {
+				submitted++
+				return tt.routing
+			}}
+			req := httptest.NewRequest(http.MethodPost, "/qso", strings.NewReader(tt.body))
+			req.Header.Set("Authorization", "Bearer secret")
+			rec := httptest.NewRecorder()
+			s.handleQSO(rec, req)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status code = %d, body %s", rec.Code, rec.Body)
+			}
+			var resp Response
+			if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+				t.Fatal(err)
+			}
+			if got := resp.Results[0].Status; got != tt.want {
+				t.Errorf("status = %q, want %q", got, tt.want)
+			}
+			if got := [3]int{resp.Queued, resp.Filtered, resp.Rejected}; got != tt.counts {
+				t.Errorf("counts = %v, want %v", got, tt.counts)
+			}
+			if tt.want == "rejected" && resp.Results[0].Error == "" {
+				t.Error("rejected record has no error")
+			}
+			if tt.name == "invalid" && submitted != 0 {
+				t.Error("invalid record was submitted")
+			}
+		})
+	}
+}
+
+func TestResultJSON(t *testing.T) {
+	routing := Routing{Queued: []string{"qrz"}, Failed: map[string]string{"lotw": "disk full"}}
+	data, err := json.Marshal(Result{Status: routing.status(), Routing: routing})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"index":0,"status":"queued","queued":["qrz"],"failed":{"lotw":"disk full"}}`
+	if string(data) != want {
+		t.Errorf("json = %s, want %s", data, want)
+	}
+}
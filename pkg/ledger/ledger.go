@@ -0,0 +1,175 @@
+package ledger
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Outcome 是一次投递事件的结果
+type Outcome string
+
+const (
+	// Queued 表示记录已进入某个目标的上传队列
+	Queued Outcome = "queued"
+	// Delivered 表示目标已接受记录
+	Delivered Outcome = "delivered"
+	// Failed 表示一次上传失败
+	Failed Outcome = "failed"
+)
+
+// Entry 是账本中的一行，记录某个 QSO 在某个目标上的一次事件。
+// Record 只在 Queued 和 Failed 中保存，用于之后重新发送
+type Entry struct {
+	Time     time.Time `json:"time"`
+	Identity string    `json:"identity"`
+	Target   string    `json:"target"`
+	Outcome  Outcome   `json:"outcome"`
+	Error    string    `json:"error,omitempty"`
+	Record   string    `json:"record,omitempty"`
+}
+
+// Ledger 是只追加的 JSON Lines 投递账本。
+// 使用普通文件而不是数据库，这样守护进程运行时其他命令也可以读取
+type Ledger struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// Open 打开（或创建）位于 path 的账本用于追加
+func Open(path string) (*Ledger, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create state directory: %w", err)
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open ledger: %w", err)
+	}
+	return &Ledger{file: f}, nil
+}
+
+// Append 追加一条事件，Time 为空时使用当前时间
+func (l *Ledger) Append(e Entry) error {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, err = l.file.Write(append(data, '\n'))
+	return err
+}
+
+// Result 追加一次上传的结果，err 为 nil 时记为 Delivered
+func (l *Ledger) Result(target, identity, record string, err error) error {
+	if err == nil {
+		return l.Append(Entry{Identity: identity, Target: target, Outcome: Delivered})
+	}
+	return l.Append(Entry{Identity: identity, Target: target, Outcome: Failed, Error: err.Error(), Record: record})
+}
+
+// Close 关闭账本文件
+func (l *Ledger) Close() error {
+	return l.file.Close()
+}
+
+// Read 按写入顺序读取账本中的所有事件，账本不存在时返回空。
+// 无法解析的行（例如崩溃时写了一半的最后一行）会被跳过
+func Read(path string) ([]Entry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []Entry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var e Entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			continue
+		}
+		entries = append(entries, e)
+	}
+	return entries, scanner.Err()
+}
+
+// TargetState 是某个 QSO 在某个目标上的投递状态
+type TargetState struct {
+	Delivered bool
+	Attempts  int
+	LastTry   time.Time
+	LastError string
+}
+
+// QSO 汇总了一个 QSO 的所有投递事件
+type QSO struct {
+	Identity  string
+	Record    string
+	FirstSeen time.Time
+	Targets   map[string]*TargetState
+	Entries   []Entry
+}
+
+// Summarize 按 QSO 身份汇总事件，按首次出现的时间排序
+func Summarize(entries []Entry) []*QSO {
+	byID := make(map[string]*QSO)
+	var qsos []*QSO
+	for _, e := range entries {
+		q, ok := byID[e.Identity]
+		if !ok {
+			q = &QSO{Identity: e.Identity, FirstSeen: e.Time, Targets: make(map[string]*TargetState)}
+			byID[e.Identity] = q
+			qsos = append(qsos, q)
+		}
+		q.Entries = append(q.Entries, e)
+		if e.Record != "" {
+			q.Record = e.Record
+		}
+		state, ok := q.Targets[e.Target]
+		if !ok {
+			state = &TargetState{}
+			q.Targets[e.Target] = state
+		}
+		switch e.Outcome {
+		case Delivered:
+			state.Delivered = true
+			state.Attempts++
+			state.LastTry = e.Time
+			state.LastError = ""
+		case Failed:
+			state.Attempts++
+			state.LastTry = e.Time
+			state.LastError = e.Error
+		}
+	}
+	slices.SortStableFunc(qsos, func(a, b *QSO) int {
+		return a.FirstSeen.Compare(b.FirstSeen)
+	})
+	return qsos
+}
+
+// Missing 返回记录过这个 QSO、但还没有成功投递的目标，按名称排序
+func (q *QSO) Missing() []string {
+	var missing []string
+	for target, state := range q.Targets {
+		if !state.Delivered {
+			missing = append(missing, target)
+		}
+	}
+	slices.Sort(missing)
+	return missing
+}
@@ -0,0 +1,134 @@
+package n1mm
+
+import (
+	"errors"
+	"log/slog"
+	"net"
+
+	"git.esd.cc/imlonghao/adif2cloud/pkg/adif"
+	"git.esd.cc/imlonghao/adif2cloud/pkg/source"
+)
+
+// Config 定义了 N1MM Logger+ UDP 来源的配置
+type Config struct {
+	// Listen 是监听的地址，N1MM 默认广播到 12060 端口，例如 0.0.0.0:12060
+	Listen string `mapstructure:"listen"`
+	// Interface 是加入组播组使用的网卡名称，只在 Listen 为组播地址时使用
+	Interface string `mapstructure:"interface"`
+}
+
+// Listener 接收 N1MM Logger+ 广播的联络消息。新联络作为新增事件上报，
+// 修改和删除按联络的 ID 关联到之前收到的联络，作为修改和删除事件上报。
+// 修改本次运行之前记录的联络同样作为修改事件上报，它可能已经上传过，不作为新 QSO 上传
+type Listener struct {
+	addr     *net.UDPAddr
+	conn     *net.UDPConn
+	callback func(source.Event)
+	// contacts 保存本次运行中收到的联络，键为 Contact.Key
+	contacts map[string]contact
+
+	started bool
+	done    chan struct{}
+}
+
+// contact 是一个已上报联络的 QSO 身份和内容指纹
+type contact struct {
+	identity    string
+	fingerprint string
+}
+
+// NewListener 创建 N1MM 来源并开始监听
+func NewListener(cfg Config, callback func(source.Event)) (*Listener, error) {
+	slog.Info("Creating N1MM listener", "listen", cfg.Listen)
+	conn, addr, err := source.ListenUDP(cfg.Listen, cfg.Interface)
+	if err != nil {
+		return nil, err
+	}
+	return &Listener{
+		addr:     addr,
+		conn:     conn,
+		callback: callback,
+		contacts: make(map[string]contact),
+		done:     make(chan struct{}),
+	}, nil
+}
+
+func (l *Listener) Start() error {
+	slog.Info("Starting N1MM listener", "listen", l.addr.String())
+	l.started = true
+	go l.listen()
+	return nil
+}
+
+func (l *Listener) listen() {
+	defer close(l.done)
+	buf := make([]byte, 64*1024)
+	for {
+		n, from, err := l.conn.ReadFromUDP(buf)
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				slog.Error("Failed to read N1MM message", "error", err)
+			}
+			return
+		}
+		kind, c, err := Decode(buf[:n])
+		if err != nil {
+			slog.Debug("Ignoring invalid N1MM message", "from", from, "error", err)
+			continue
+		}
+		l.handle(kind, c)
+	}
+}
+
+func (l *Listener) handle(kind string, c *Contact) {
+	logger := slog.With("station", c.StationName, "id", c.ID, "call", c.Call)
+	key := c.Key()
+	previous, known := l.contacts[key]
+
+	switch kind {
+	case KindContactInfo, KindContactReplace:
+		fields, err := c.Fields()
+		if err != nil {
+			logger.Warn("Ignoring N1MM contact that cannot be converted", "error", err)
+			return
+		}
+		record, err := adif.FormatRecord(fields)
+		if err != nil {
+			logger.Warn("Ignoring N1MM contact that cannot be converted", "error", err)
+			return
+		}
+		current := contact{identity: adif.Identity(fields), fingerprint: adif.Fingerprint(fields)}
+		l.contacts[key] = current
+
+		switch {
+		case known && previous == current:
+			// 联网的多台电脑会重复广播同一个联络
+			logger.Debug("Ignoring N1MM contact that is already known")
+		case known:
+			logger.Info("Received changed contact from N1MM", "kind", kind)
+			l.callback(source.Event{Kind: source.Updated, Identity: current.identity, Record: record})
+		case kind == KindContactReplace:
+			logger.Info("Received change of N1MM contact not received in this run")
+			l.callback(source.Event{Kind: source.Updated, Identity: current.identity, Record: record})
+		default:
+			logger.Info("Received contact from N1MM")
+			l.callback(source.Event{Kind: source.Added, Identity: current.identity, Record: record})
+		}
+	case KindContactDelete:
+		if !known {
+			logger.Warn("Ignoring delete of N1MM contact not received in this run")
+			return
+		}
+		delete(l.contacts, key)
+		logger.Info("Received deleted contact from N1MM")
+		l.callback(source.Event{Kind: source.Deleted, Identity: previous.identity})
+	}
+}
+
+func (l *Listener) Close() {
+	slog.Info("Closing N1MM listener", "listen", l.addr.String())
+	l.conn.Close()
+	if l.started {
+		<-l.done
+	}
+}
@@ -0,0 +1,91 @@
+package n1mm
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"git.esd.cc/imlonghao/adif2cloud/pkg/source"
+)
+
+func TestListenerEvents(t *testing.T) {
+	newContact := func(id, call, comment string) *Contact {
+		return &Contact{ID: id, Call: call, Timestamp: "2024-10-26 12:00:00", Mode: "CW", TxFreq: "702500", Comment: comment}
+	}
+	type message struct {
+		kind    string
+		contact *Contact
+	}
+	tests := []struct {
+		name     string
+		messages []message
+		want     []string
+	}{
+		{
+			name:     "new contact",
+			messages: []message{{KindContactInfo, newContact("1", "K1ABC", "")}},
+			want:     []string{"added K1ABC"},
+		},
+		{
+			name: "repeated broadcast is ignored",
+			messages: []message{
+				{KindContactInfo, newContact("1", "K1ABC", "")},
+				{KindContactInfo, newContact("1", "K1ABC", "")},
+				{KindContactReplace, newContact("1", "K1ABC", "")},
+			},
+			want: []string{"added K1ABC"},
+		},
+		{
+			name: "edit of a known contact",
+			messages: []message{
+				{KindContactInfo, newContact("1", "K1ABC", "")},
+				{KindContactReplace, newContact("1", "K1ABC", "73")},
+			},
+			want: []string{"added K1ABC", "updated K1ABC"},
+		},
+		{
+			name: "callsign correction is an update",
+			messages: []message{
+				{KindContactInfo, newContact("1", "K1ABD", "")},
+				{KindContactReplace, newContact("1", "K1ABC", "")},
+			},
+			want: []string{"added K1ABD", "updated K1ABC"},
+		},
+		{
+			name:     "edit of a contact from before this run is not uploaded",
+			messages: []message{{KindContactReplace, newContact("1", "K1ABC", "73")}},
+			want:     []string{"updated K1ABC"},
+		},
+		{
+			name: "delete",
+			messages: []message{
+				{KindContactInfo, newContact("1", "K1ABC", "")},
+				{KindContactDelete, &Contact{ID: "1", Call: "K1ABC"}},
+				{KindContactDelete, &Contact{ID: "2", Call: "K2ABC"}},
+			},
+			want: []string{"added K1ABC", "deleted K1ABC"},
+		},
+		{
+			name:     "contact without call is ignored",
+			messages: []message{{KindContactInfo, newContact("1", "", "")}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			l := &Listener{
+				contacts: make(map[string]contact),
+				callback: func(e source.Event) {
+					call, _, _ := strings.Cut(e.Identity, "|")
+					got = append(got, e.Kind.String()+" "+call)
+				},
+			}
+			for _, m := range tt.messages {
+				l.handle(m.kind, m.contact)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("events = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
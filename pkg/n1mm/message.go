@@ -0,0 +1,142 @@
+package n1mm
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"git.esd.cc/imlonghao/adif2cloud/pkg/adif"
+)
+
+// N1MM Logger+ 广播的联络消息类型，其余消息（RadioInfo、spot 等）被忽略
+const (
+	KindContactInfo    = "contactinfo"
+	KindContactReplace = "contactreplace"
+	KindContactDelete  = "contactdelete"
+)
+
+// Contact 是 contactinfo、contactreplace 和 contactdelete 消息的内容，
+// contactdelete 只包含 Timestamp、Call、StationName 和 ID
+type Contact struct {
+	XMLName     xml.Name
+	App         string `xml:"app"`
+	ContestName string `xml:"contestname"`
+	Timestamp   string `xml:"timestamp"`
+	MyCall      string `xml:"mycall"`
+	Band        string `xml:"band"`
+	// RxFreq 和 TxFreq 的单位是 10 Hz
+	RxFreq      string `xml:"rxfreq"`
+	TxFreq      string `xml:"txfreq"`
+	Operator    string `xml:"operator"`
+	Mode        string `xml:"mode"`
+	Call        string `xml:"call"`
+	Snt         string `xml:"snt"`
+	SntNr       string `xml:"sntnr"`
+	Rcv         string `xml:"rcv"`
+	RcvNr       string `xml:"rcvnr"`
+	Gridsquare  string `xml:"gridsquare"`
+	Exchange1   string `xml:"exchange1"`
+	Section     string `xml:"section"`
+	Comment     string `xml:"comment"`
+	QTH         string `xml:"qth"`
+	Name        string `xml:"name"`
+	Power       string `xml:"power"`
+	Prec        string `xml:"prec"`
+	Ck          string `xml:"ck"`
+	StationName string `xml:"StationName"`
+	// ID 是 N1MM 为每个联络生成的唯一标识，修改和删除消息用它引用原来的联络
+	ID string `xml:"ID"`
+}
+
+// Decode 解码一个 UDP 数据报，返回消息类型（根元素名称的小写）和内容
+func Decode(data []byte) (string, *Contact, error) {
+	var c Contact
+	if err := xml.Unmarshal(data, &c); err != nil {
+		return "", nil, fmt.Errorf("invalid N1MM message: %w", err)
+	}
+	return strings.ToLower(c.XMLName.Local), &c, nil
+}
+
+// Key 返回用于关联同一个联络的键，旧版本没有 ID 时使用呼号和时间
+func (c *Contact) Key() string {
+	if id := strings.TrimSpace(c.ID); id != "" {
+		return id
+	}
+	return strings.ToUpper(strings.TrimSpace(c.Call)) + "|" + strings.TrimSpace(c.Timestamp)
+}
+
+// Fields 把联络转换为 ADIF 字段
+func (c *Contact) Fields() (map[string]string, error) {
+	call := strings.ToUpper(strings.TrimSpace(c.Call))
+	if call == "" {
+		return nil, errors.New("contact has no call")
+	}
+	t, err := time.ParseInLocation("2006-01-02 15:04:05", strings.TrimSpace(c.Timestamp), time.UTC)
+	if err != nil {
+		return nil, fmt.Errorf("invalid contact timestamp %q", c.Timestamp)
+	}
+
+	fields := map[string]string{
+		"call":             call,
+		"qso_date":         t.Format("20060102"),
+		"time_on":          t.Format("150405"),
+		"station_callsign": strings.ToUpper(strings.TrimSpace(c.MyCall)),
+		"operator":         strings.ToUpper(strings.TrimSpace(c.Operator)),
+		"rst_sent":         strings.TrimSpace(c.Snt),
+		"rst_rcvd":         strings.TrimSpace(c.Rcv),
+		"gridsquare":       strings.TrimSpace(c.Gridsquare),
+		"srx_string":       strings.TrimSpace(c.Exchange1),
+		"arrl_sect":        strings.TrimSpace(c.Section),
+		"comment":          strings.TrimSpace(c.Comment),
+		"qth":              strings.TrimSpace(c.QTH),
+		"name":             strings.TrimSpace(c.Name),
+		"rx_pwr":           strings.TrimSpace(c.Power),
+		"precedence":       strings.TrimSpace(c.Prec),
+		"contest_id":       strings.TrimSpace(c.ContestName),
+		"app_n1mm_id":      strings.TrimSpace(c.ID),
+	}
+	if nr := strings.TrimSpace(c.SntNr); nr != "" && nr != "0" {
+		fields["stx"] = nr
+	}
+	if nr := strings.TrimSpace(c.RcvNr); nr != "" && nr != "0" {
+		fields["srx"] = nr
+	}
+	if ck := strings.TrimSpace(c.Ck); ck != "" && ck != "0" {
+		fields["check"] = ck
+	}
+
+	// N1MM 用 USB/LSB 表示 SSB，ADIF 中它们是 SSB 的子模式
+	switch mode := strings.ToUpper(strings.TrimSpace(c.Mode)); mode {
+	case "USB", "LSB":
+		fields["mode"] = "SSB"
+		fields["submode"] = mode
+	default:
+		fields["mode"] = mode
+	}
+
+	txMHz := freqMHz(c.TxFreq)
+	if txMHz > 0 {
+		fields["freq"] = strconv.FormatFloat(txMHz, 'f', -1, 64)
+		fields["band"] = adif.FreqToBand(txMHz)
+	} else if band, err := strconv.ParseFloat(strings.TrimSpace(c.Band), 64); err == nil {
+		// band 是波段的起始频率（MHz），例如 3.5、14
+		fields["band"] = adif.FreqToBand(band)
+	}
+	if rxMHz := freqMHz(c.RxFreq); rxMHz > 0 && rxMHz != txMHz {
+		fields["freq_rx"] = strconv.FormatFloat(rxMHz, 'f', -1, 64)
+		fields["band_rx"] = adif.FreqToBand(rxMHz)
+	}
+	return fields, nil
+}
+
+// freqMHz 把以 10 Hz 为单位的频率转换为 MHz，无效时返回 0
+func freqMHz(s string) float64 {
+	v, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err != nil || v <= 0 {
+		return 0
+	}
+	return v / 1e5
+}
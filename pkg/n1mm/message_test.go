@@ -0,0 +1,118 @@
+package n1mm
+
+import (
+	"maps"
+	"testing"
+)
+
+const contactInfo = `<?xml version="1.0" encoding="utf-8"?>
+<contactinfo>
+	<app>N1MM</app>
+	<contestname>CQWWSSB</contestname>
+	<timestamp>2024-10-26 00:01:02</timestamp>
+	<mycall>N0CALL</mycall>
+	<band>14</band>
+	<rxfreq>1420000</rxfreq>
+	<txfreq>1420000</txfreq>
+	<operator>n0call</operator>
+	<mode>USB</mode>
+	<call>k1abc</call>
+	<snt>59</snt>
+	<sntnr>5</sntnr>
+	<rcv>59</rcv>
+	<rcvnr>0</rcvnr>
+	<gridsquare>FN42</gridsquare>
+	<exchange1>5</exchange1>
+	<comment></comment>
+	<StationName>CONTEST-PC</StationName>
+	<ID>f9ffac4fcd3e479ca86e137df1338531</ID>
+</contactinfo>`
+
+func TestDecode(t *testing.T) {
+	kind, c, err := Decode([]byte(contactInfo))
+	if err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+	if kind != KindContactInfo || c.Call != "k1abc" || c.StationName != "CONTEST-PC" {
+		t.Errorf("Decode() = %q, %+v", kind, c)
+	}
+	if _, _, err := Decode([]byte("<contactinfo>")); err == nil {
+		t.Error("Decode() of a truncated message expected an error")
+	}
+}
+
+func TestContactFields(t *testing.T) {
+	tests := []struct {
+		name    string
+		contact Contact
+		want    map[string]string
+		wantErr bool
+	}{
+		{
+			name: "USB is an SSB submode",
+			contact: Contact{
+				Timestamp: "2024-10-26 00:01:02", Call: "k1abc", MyCall: "n0call", Mode: "USB",
+				TxFreq: "1420000", RxFreq: "1420000", Snt: "59", Rcv: "59", SntNr: "5", RcvNr: "0",
+				ContestName: "CQWWSSB", ID: "abc",
+			},
+			want: map[string]string{
+				"call": "K1ABC", "qso_date": "20241026", "time_on": "000102", "station_callsign": "N0CALL",
+				"mode": "SSB", "submode": "USB", "freq": "14.2", "band": "20m",
+				"rst_sent": "59", "rst_rcvd": "59", "stx": "5", "contest_id": "CQWWSSB", "app_n1mm_id": "abc",
+			},
+		},
+		{
+			name: "split frequencies",
+			contact: Contact{
+				Timestamp: "2024-10-26 12:00:00", Call: "K1ABC", Mode: "CW",
+				TxFreq: "702500", RxFreq: "705000", RcvNr: "123", Ck: "75",
+			},
+			want: map[string]string{
+				"call": "K1ABC", "qso_date": "20241026", "time_on": "120000", "mode": "CW",
+				"freq": "7.025", "band": "40m", "freq_rx": "7.05", "band_rx": "40m", "srx": "123", "check": "75",
+			},
+		},
+		{
+			name:    "band without frequency",
+			contact: Contact{Timestamp: "2024-10-26 12:00:00", Call: "K1ABC", Mode: "FT8", Band: "3.5"},
+			want: map[string]string{
+				"call": "K1ABC", "qso_date": "20241026", "time_on": "120000", "mode": "FT8", "band": "80m",
+			},
+		},
+		{
+			name:    "no call",
+			contact: Contact{Timestamp: "2024-10-26 12:00:00"},
+			wantErr: true,
+		},
+		{
+			name:    "invalid timestamp",
+			contact: Contact{Timestamp: "26/10/2024", Call: "K1ABC"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.contact.Fields()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Fields() error = %v, want error %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			// 空字段不写入记录，比较时去掉
+			maps.DeleteFunc(got, func(_, v string) bool { return v == "" })
+			if !maps.Equal(got, tt.want) {
+				t.Errorf("Fields() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestContactKey(t *testing.T) {
+	if got := (&Contact{ID: " abc ", Call: "K1ABC"}).Key(); got != "abc" {
+		t.Errorf("Key() with ID = %q, want abc", got)
+	}
+	if got := (&Contact{Call: "k1abc", Timestamp: "2024-10-26 12:00:00"}).Key(); got != "K1ABC|2024-10-26 12:00:00" {
+		t.Errorf("Key() without ID = %q", got)
+	}
+}
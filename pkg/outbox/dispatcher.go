@@ -0,0 +1,209 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+	"time"
+
+	"git.esd.cc/imlonghao/adif2cloud/pkg/adif"
+	"git.esd.cc/imlonghao/adif2cloud/pkg/filter"
+	"git.esd.cc/imlonghao/adif2cloud/pkg/ledger"
+	"git.esd.cc/imlonghao/adif2cloud/pkg/provider"
+)
+
+// Target 是一个带配置名称的提供商。Name 在所有目标中唯一，用作队列和投递账本中的键，
+// 与命令行中引用目标的名称一致，Filter 为 nil 时接收所有记录
+type Target struct {
+	Name     string
+	Provider provider.Provider
+	Filter   *filter.Filter
+}
+
+// Dispatcher 把新记录分发给每个目标各自的 Worker
+type Dispatcher struct {
+	outbox  *Outbox
+	ledger  *ledger.Ledger
+	workers []*Worker
+}
+
+// NewDispatcher 创建一个新的 Dispatcher 实例，每个目标一个 Worker。
+// l 不为 nil 时把入队和每次上传的结果写入账本
+func NewDispatcher(ctx context.Context, o *Outbox, targets []Target, l *ledger.Ledger) *Dispatcher {
+	d := &Dispatcher{outbox: o, ledger: l}
+	for _, t := range targets {
+		d.workers = append(d.workers, NewWorker(ctx, o, t, l))
+	}
+	return d
+}
+
+// Submission 是一条记录交给各个目标的结果
+type Submission struct {
+	// Queued 是已写入队列的目标
+	Queued []string
+	// Skipped 是没有接收这条记录的目标：被过滤规则排除，或者上传整个源文件而记录不是来自文件
+	Skipped []string
+	// Failed 是写入队列失败的目标及其错误
+	Failed map[string]error
+}
+
+// Err 返回所有写入队列失败的错误，都成功时返回 nil
+func (s Submission) Err() error {
+	names := slices.Sorted(maps.Keys(s.Failed))
+	errs := make([]error, len(names))
+	for i, name := range names {
+		errs[i] = fmt.Errorf("%s: %w", name, s.Failed[name])
+	}
+	return errors.Join(errs...)
+}
+
+// Submit 先把记录写入每个目标的队列，再唤醒对应的 Worker，不会阻塞。
+// filename 为空表示记录不是来自文件，上传整个源文件的提供商会跳过它。
+// 返回写入队列失败的错误，其他提供商不受影响
+func (d *Dispatcher) Submit(filename, line string) error {
+	return d.SubmitTo(nil, filename, line).Err()
+}
+
+// SubmitTo 与 Submit 相同，但只交给 targets 中列出名称的目标，targets 为空时交给所有目标。
+// 返回每个目标的结果，不在 targets 中的目标不出现在结果里
+func (d *Dispatcher) SubmitTo(targets []string, filename, line string) Submission {
+	fields := adif.Parse(line)
+	identity := adif.Identity(fields)
+	var result Submission
+	for _, w := range d.workers {
+		if len(targets) > 0 && !slices.Contains(targets, w.name) {
+			continue
+		}
+		if filename == "" && provider.UploadsFile(w.provider) {
+			slog.Debug("Skipping QSO without a source file for target that uploads the whole file", "target", w.name, "identity", identity)
+			result.Skipped = append(result.Skipped, w.name)
+			continue
+		}
+		if ok, reason := w.filter.Match(fields); !ok {
+			slog.Debug("Skipping QSO filtered out for target", "target", w.name, "identity", identity, "reason", reason)
+			result.Skipped = append(result.Skipped, w.name)
+			continue
+		}
+		if _, err := d.outbox.Enqueue(w.name, Entry{Filename: filename, Line: line}); err != nil {
+			slog.Error("Failed to enqueue QSO record", "target", w.name, "error", err)
+			if result.Failed == nil {
+				result.Failed = make(map[string]error)
+			}
+			result.Failed[w.name] = err
+			continue
+		}
+		result.Queued = append(result.Queued, w.name)
+		if d.ledger != nil {
+			if err := d.ledger.Append(ledger.Entry{Identity: identity, Target: w.name, Outcome: ledger.Queued, Record: line}); err != nil {
+				slog.Warn("Failed to write delivery ledger", "error", err)
+			}
+		}
+		w.Wake()
+	}
+	return result
+}
+
+// SubmitBatch 把 lines 中通过过滤规则的记录交给名为 target 的目标。
+// 上传整个源文件的目标只入队一次，一次上传就包含了所有记录
+func (d *Dispatcher) SubmitBatch(target, filename string, lines []string) (int, error) {
+	i := slices.IndexFunc(d.workers, func(w *Worker) bool { return w.name == target })
+	if i < 0 {
+		return 0, fmt.Errorf("unknown target %q", target)
+	}
+	w := d.workers[i]
+
+	var accepted []string
+	for _, line := range lines {
+		fields := adif.Parse(line)
+		if ok, reason := w.filter.Match(fields); !ok {
+			slog.Debug("Skipping QSO filtered out for target", "target", w.name, "identity", adif.Identity(fields), "reason", reason)
+			continue
+		}
+		accepted = append(accepted, line)
+	}
+	if len(accepted) == 0 {
+		return 0, nil
+	}
+
+	entries := make([]Entry, len(accepted))
+	for j, line := range accepted {
+		entries[j] = Entry{Filename: filename, Line: line}
+	}
+	if provider.UploadsFile(w.provider) {
+		entries = []Entry{{Filename: filename, Line: accepted[len(accepted)-1], Records: accepted}}
+	}
+	for _, e := range entries {
+		if _, err := d.outbox.Enqueue(w.name, e); err != nil {
+			slog.Error("Failed to enqueue QSO record", "target", w.name, "error", err)
+			return 0, fmt.Errorf("%s: %w", w.name, err)
+		}
+	}
+	if d.ledger != nil {
+		for _, line := range accepted {
+			if err := d.ledger.Append(ledger.Entry{Identity: adif.Identity(adif.Parse(line)), Target: w.name, Outcome: ledger.Queued, Record: line}); err != nil {
+				slog.Warn("Failed to write delivery ledger", "error", err)
+				break
+			}
+		}
+	}
+	w.Wake()
+	return len(accepted), nil
+}
+
+// Start 启动所有 Worker
+func (d *Dispatcher) Start() {
+	for _, w := range d.workers {
+		w.Start()
+	}
+}
+
+// ShutdownResult 是某个目标在退出时的投递情况
+type ShutdownResult struct {
+	Target string
+	// Flushed 是开始退出后上传成功的记录数
+	Flushed int
+	// Interrupted 表示宽限期结束时仍有上传在进行并被中止
+	Interrupted bool
+	// Pending 是留在队列中、下次启动后继续投递的记录数，读取失败时为 -1
+	Pending int
+}
+
+// Shutdown 停止所有 Worker。Worker 会继续上传队列中剩余的记录，
+// 超过 grace 后中止仍在进行的上传，未确认的记录保留在队列中
+func (d *Dispatcher) Shutdown(grace time.Duration) []ShutdownResult {
+	for _, w := range d.workers {
+		w.Stop()
+	}
+	deadline := time.NewTimer(grace)
+	defer deadline.Stop()
+	for _, w := range d.workers {
+		select {
+		case <-w.done:
+		case <-deadline.C:
+			for _, w := range d.workers {
+				w.Abort()
+			}
+			w.Wait()
+		}
+	}
+
+	results := make([]ShutdownResult, len(d.workers))
+	for i, w := range d.workers {
+		w.Wait()
+		w.Abort()
+		pending, err := d.outbox.Len(w.name)
+		if err != nil {
+			pending = -1
+		}
+		results[i] = ShutdownResult{
+			Target:      w.name,
+			Flushed:     w.flushed,
+			Interrupted: w.interrupted,
+			Pending:     pending,
+		}
+	}
+	return results
+}
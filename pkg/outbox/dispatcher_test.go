@@ -0,0 +1,60 @@
+package outbox
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"git.esd.cc/imlonghao/adif2cloud/pkg/filter"
+)
+
+// fileProvider 上传整个源文件
+type fileProvider struct{ fakeProvider }
+
+func (p *fileProvider) UploadsFile() bool { return true }
+
+func TestSubmitTo(t *testing.T) {
+	const record = "<call:5>BA1AA<band:3>20m<qso_date:8>20240101<time_on:4>1200<eor>"
+	only40m, err := filter.Compile(filter.Config{Include: []filter.Rule{{Field: "band", Equals: "40m"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name        string
+		targets     []string
+		filename    string
+		wantQueued  []string
+		wantSkipped []string
+	}{
+		{"all targets", nil, "log.adi", []string{"qrz", "s3"}, []string{"lotw"}},
+		{"without source file", nil, "", []string{"qrz"}, []string{"lotw", "s3"}},
+		{"selected targets", []string{"qrz", "lotw"}, "log.adi", []string{"qrz"}, []string{"lotw"}},
+		{"only filtered targets", []string{"lotw"}, "log.adi", nil, []string{"lotw"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := openTest(t)
+			d := NewDispatcher(context.Background(), o, []Target{
+				{Name: "qrz", Provider: &fakeProvider{}},
+				{Name: "lotw", Provider: &fakeProvider{}, Filter: only40m},
+				{Name: "s3", Provider: &fileProvider{}},
+			}, nil)
+			got := d.SubmitTo(tt.targets, tt.filename, record)
+			if !slices.Equal(got.Queued, tt.wantQueued) {
+				t.Errorf("Queued = %q, want %q", got.Queued, tt.wantQueued)
+			}
+			if !slices.Equal(got.Skipped, tt.wantSkipped) {
+				t.Errorf("Skipped = %q, want %q", got.Skipped, tt.wantSkipped)
+			}
+			if err := got.Err(); err != nil {
+				t.Errorf("Err() = %v", err)
+			}
+			for _, name := range []string{"qrz", "lotw", "s3"} {
+				queued := len(lines(t, o, name)) > 0
+				if queued != slices.Contains(tt.wantQueued, name) {
+					t.Errorf("queue %s has records = %v", name, queued)
+				}
+			}
+		})
+	}
+}
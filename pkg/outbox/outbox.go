@@ -0,0 +1,171 @@
+package outbox
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Entry 是一条等待投递到某个提供商的记录
+type Entry struct {
+	Filename string `json:"filename"`
+	Line     string `json:"line"`
+	// Records 是一次上传整个文件时送达的全部记录，只用于写入账本，为空时只有 Line
+	Records  []string  `json:"records,omitempty"`
+	Attempts int       `json:"attempts"`
+	Created  time.Time `json:"created"`
+	LastErr  string    `json:"last_error,omitempty"`
+}
+
+// Item 是队列中带序号的 Entry
+type Item struct {
+	ID uint64
+	Entry
+}
+
+// Outbox 是基于 bbolt 的持久化队列，每个目标一个 bucket
+type Outbox struct {
+	db *bolt.DB
+}
+
+// Open 打开（或创建）位于 path 的队列数据库
+func Open(path string) (*Outbox, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create state directory: %w", err)
+	}
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open outbox: %w", err)
+	}
+	return &Outbox{db: db}, nil
+}
+
+// Enqueue 将记录追加到指定队列的末尾
+func (o *Outbox) Enqueue(queue string, e Entry) (uint64, error) {
+	if e.Created.IsZero() {
+		e.Created = time.Now()
+	}
+	var id uint64
+	err := o.db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte(queue))
+		if err != nil {
+			return err
+		}
+		id, err = b.NextSequence()
+		if err != nil {
+			return err
+		}
+		data, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		return b.Put(itob(id), data)
+	})
+	return id, err
+}
+
+// Peek 返回指定队列中最早的一条记录，队列为空时返回 nil
+func (o *Outbox) Peek(queue string) (*Item, error) {
+	var item *Item
+	err := o.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(queue))
+		if b == nil {
+			return nil
+		}
+		k, v := b.Cursor().First()
+		if k == nil {
+			return nil
+		}
+		item = &Item{ID: binary.BigEndian.Uint64(k)}
+		return json.Unmarshal(v, &item.Entry)
+	})
+	return item, err
+}
+
+// Update 覆盖队列中已有的记录，用于记录重试次数和错误
+func (o *Outbox) Update(queue string, item Item) error {
+	return o.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(queue))
+		if b == nil || b.Get(itob(item.ID)) == nil {
+			return nil
+		}
+		data, err := json.Marshal(item.Entry)
+		if err != nil {
+			return err
+		}
+		return b.Put(itob(item.ID), data)
+	})
+}
+
+// Ack 在提供商确认后从队列中删除记录
+func (o *Outbox) Ack(queue string, id uint64) error {
+	return o.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(queue))
+		if b == nil {
+			return nil
+		}
+		return b.Delete(itob(id))
+	})
+}
+
+// Remove 删除指定队列中内容为 line 的记录，返回删除的条数。
+// 用于记录已经通过其他途径送达（例如 retry 命令）之后避免重复上传
+func (o *Outbox) Remove(queue string, line string) (int, error) {
+	var n int
+	err := o.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(queue))
+		if b == nil {
+			return nil
+		}
+		var ids [][]byte
+		err := b.ForEach(func(k, v []byte) error {
+			var e Entry
+			if err := json.Unmarshal(v, &e); err != nil {
+				return err
+			}
+			if e.Line == line {
+				ids = append(ids, k)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, id := range ids {
+			if err := b.Delete(id); err != nil {
+				return err
+			}
+		}
+		n = len(ids)
+		return nil
+	})
+	return n, err
+}
+
+// Len 返回指定队列中待投递的记录数
+func (o *Outbox) Len(queue string) (int, error) {
+	var n int
+	err := o.db.View(func(tx *bolt.Tx) error {
+		if b := tx.Bucket([]byte(queue)); b != nil {
+			n = b.Stats().KeyN
+		}
+		return nil
+	})
+	return n, err
+}
+
+// Close 关闭队列数据库
+func (o *Outbox) Close() error {
+	return o.db.Close()
+}
+
+func itob(v uint64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, v)
+	return b
+}
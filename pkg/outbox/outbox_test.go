@@ -0,0 +1,113 @@
+package outbox
+
+import (
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func openTest(t *testing.T) *Outbox {
+	t.Helper()
+	o, err := Open(filepath.Join(t.TempDir(), "outbox.db"))
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	t.Cleanup(func() { o.Close() })
+	return o
+}
+
+// lines 依次取出队列中的全部记录
+func lines(t *testing.T, o *Outbox, queue string) []string {
+	t.Helper()
+	var got []string
+	for {
+		item, err := o.Peek(queue)
+		if err != nil {
+			t.Fatalf("Peek() error = %v", err)
+		}
+		if item == nil {
+			return got
+		}
+		got = append(got, item.Line)
+		if err := o.Ack(queue, item.ID); err != nil {
+			t.Fatalf("Ack() error = %v", err)
+		}
+	}
+}
+
+func TestQueue(t *testing.T) {
+	tests := []struct {
+		name    string
+		enqueue map[string][]string
+		remove  map[string]string
+		want    map[string][]string
+	}{
+		{
+			name:    "first in first out",
+			enqueue: map[string][]string{"a": {"1", "2", "3"}},
+			want:    map[string][]string{"a": {"1", "2", "3"}},
+		},
+		{
+			name:    "queues are independent",
+			enqueue: map[string][]string{"a": {"1", "2"}, "b": {"3"}},
+			want:    map[string][]string{"a": {"1", "2"}, "b": {"3"}, "c": nil},
+		},
+		{
+			name:    "remove by content keeps the order of the rest",
+			enqueue: map[string][]string{"a": {"1", "2", "1", "3"}, "b": {"1"}},
+			remove:  map[string]string{"a": "1"},
+			want:    map[string][]string{"a": {"2", "3"}, "b": {"1"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := openTest(t)
+			for queue, ls := range tt.enqueue {
+				for _, l := range ls {
+					if _, err := o.Enqueue(queue, Entry{Line: l}); err != nil {
+						t.Fatalf("Enqueue() error = %v", err)
+					}
+				}
+			}
+			for queue, line := range tt.remove {
+				if _, err := o.Remove(queue, line); err != nil {
+					t.Fatalf("Remove() error = %v", err)
+				}
+			}
+			for queue, want := range tt.want {
+				if n, err := o.Len(queue); err != nil || n != len(want) {
+					t.Errorf("Len(%q) = %d, %v, want %d", queue, n, err, len(want))
+				}
+				if got := lines(t, o, queue); !slices.Equal(got, want) {
+					t.Errorf("queue %q = %q, want %q", queue, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	o := openTest(t)
+	o.Enqueue("a", Entry{Line: "1"})
+	o.Enqueue("a", Entry{Line: "2"})
+
+	item, _ := o.Peek("a")
+	item.Attempts = 3
+	item.LastErr = "boom"
+	if err := o.Update("a", *item); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	got, _ := o.Peek("a")
+	if got.ID != item.ID || got.Line != "1" || got.Attempts != 3 || got.LastErr != "boom" {
+		t.Errorf("Peek() after Update() = %+v", got)
+	}
+
+	// 已经删除的记录不会被 Update 重新写入
+	o.Ack("a", item.ID)
+	if err := o.Update("a", *item); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	if got := lines(t, o, "a"); !slices.Equal(got, []string{"2"}) {
+		t.Errorf("queue = %q, want [2]", got)
+	}
+}
@@ -0,0 +1,214 @@
+package outbox
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"git.esd.cc/imlonghao/adif2cloud/pkg/adif"
+	"git.esd.cc/imlonghao/adif2cloud/pkg/filter"
+	"git.esd.cc/imlonghao/adif2cloud/pkg/ledger"
+	"git.esd.cc/imlonghao/adif2cloud/pkg/provider"
+)
+
+const (
+	minBackoff = 5 * time.Second
+	maxBackoff = 10 * time.Minute
+
+	// wakeBuffer 是每个 Worker 唤醒通道的容量，队列本身在磁盘上，所以满了也不会丢记录
+	wakeBuffer = 16
+
+	// maxAttempts 是一条记录最多的上传次数，超过后不再占住队列头，可以用 retry 命令重新发送
+	maxAttempts = 50
+)
+
+// Worker 在独立的 goroutine 中投递单个提供商队列里的记录，
+// 一个提供商变慢或卡住不会影响其他提供商
+type Worker struct {
+	ctx      context.Context
+	cancel   context.CancelFunc
+	outbox   *Outbox
+	ledger   *ledger.Ledger
+	provider provider.Provider
+	// name 是目标的配置名称，同时是队列和账本中的键
+	name   string
+	filter *filter.Filter
+	logger *slog.Logger
+	wake   chan struct{}
+	stop   chan struct{}
+	done   chan struct{}
+
+	// flushed 是收到 Stop 之后上传成功的记录数，interrupted 表示有上传被 Abort 中止，
+	// 两者只在 Worker 退出后读取
+	flushed     int
+	interrupted bool
+}
+
+// NewWorker 创建一个新的 Worker 实例，ctx 被取消时正在进行的上传会被中止
+func NewWorker(ctx context.Context, o *Outbox, t Target, l *ledger.Ledger) *Worker {
+	ctx, cancel := context.WithCancel(ctx)
+	return &Worker{
+		ctx:      ctx,
+		cancel:   cancel,
+		outbox:   o,
+		ledger:   l,
+		provider: t.Provider,
+		name:     t.Name,
+		filter:   t.Filter,
+		logger:   slog.With("target", t.Name, "provider", t.Provider.GetName()),
+		wake:     make(chan struct{}, wakeBuffer),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+// Wake 通知 Worker 队列中有新记录，不会阻塞
+func (w *Worker) Wake() {
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Start 启动后台投递
+func (w *Worker) Start() {
+	if n, err := w.outbox.Len(w.name); err == nil && n > 0 {
+		w.logger.Info("Resuming pending uploads", "pending", n)
+	}
+	go w.run()
+}
+
+// Stop 通知 Worker 不再等待新记录，把队列中剩余的记录上传完后退出。
+// 正在退避的 Worker 不再重试，直接退出
+func (w *Worker) Stop() {
+	close(w.stop)
+}
+
+// Abort 中止正在进行的上传，被中止的记录保留在队列中
+func (w *Worker) Abort() {
+	w.cancel()
+}
+
+// Wait 等待 Worker 退出
+func (w *Worker) Wait() {
+	<-w.done
+}
+
+func (w *Worker) run() {
+	defer close(w.done)
+	var retryAt time.Time
+	for {
+		// 退避期间不理会唤醒，避免对故障服务频繁重试
+		if !time.Now().Before(retryAt) {
+			if delay := w.drain(); delay > 0 {
+				retryAt = time.Now().Add(delay)
+			}
+		}
+
+		wait := maxBackoff
+		if d := time.Until(retryAt); d > 0 {
+			wait = d
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-w.stop:
+			timer.Stop()
+			if !time.Now().Before(retryAt) {
+				w.drain()
+			}
+			return
+		case <-w.wake:
+		case <-timer.C:
+		}
+		timer.Stop()
+	}
+}
+
+// drain 依次投递队列中的记录，队列清空或被中止时返回 0，失败时返回退避时间。
+// 被服务永久拒绝或多次失败的记录从队列中移除，账本中记为失败，不阻塞后面的记录
+func (w *Worker) drain() time.Duration {
+	for {
+		if w.ctx.Err() != nil {
+			return 0
+		}
+
+		item, err := w.outbox.Peek(w.name)
+		if err != nil {
+			w.logger.Error("Failed to read outbox", "error", err)
+			return minBackoff
+		}
+		if item == nil {
+			return 0
+		}
+
+		err = w.provider.Upload(w.ctx, item.Filename, item.Line)
+		if err != nil && w.ctx.Err() != nil {
+			// 因退出而中止，不计入重试次数
+			w.interrupted = true
+			return 0
+		}
+		w.record(item.Entry, err)
+		if err != nil {
+			item.Attempts++
+			item.LastErr = err.Error()
+			if provider.IsPermanent(err) || item.Attempts >= maxAttempts {
+				w.logger.Error("Giving up on QSO record, use the retry command to send it again",
+					"error", err, "attempts", item.Attempts, "permanent", provider.IsPermanent(err))
+				if err := w.outbox.Ack(w.name, item.ID); err != nil {
+					w.logger.Error("Failed to remove rejected record from outbox", "error", err)
+					return minBackoff
+				}
+				continue
+			}
+			if err := w.outbox.Update(w.name, *item); err != nil {
+				w.logger.Error("Failed to update outbox", "error", err)
+			}
+			delay := backoff(item.Attempts)
+			w.logger.Error("Failed to upload to provider", "error", err, "attempts", item.Attempts, "retry_in", delay)
+			return delay
+		}
+		w.logger.Info("Successfully uploaded to provider")
+		if w.stopping() {
+			w.flushed++
+		}
+		if err := w.outbox.Ack(w.name, item.ID); err != nil {
+			w.logger.Error("Failed to remove uploaded record from outbox", "error", err)
+			return minBackoff
+		}
+	}
+}
+
+// record 把一次上传的结果写入账本，整个文件的上传记入其中的每条记录
+func (w *Worker) record(e Entry, err error) {
+	if w.ledger == nil {
+		return
+	}
+	lines := e.Records
+	if len(lines) == 0 {
+		lines = []string{e.Line}
+	}
+	for _, line := range lines {
+		identity := adif.Identity(adif.Parse(line))
+		if err := w.ledger.Result(w.name, identity, line, err); err != nil {
+			w.logger.Warn("Failed to write delivery ledger", "error", err)
+			return
+		}
+	}
+}
+
+func (w *Worker) stopping() bool {
+	select {
+	case <-w.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+func backoff(attempts int) time.Duration {
+	delay := minBackoff
+	for i := 1; i < attempts && delay < maxBackoff; i++ {
+		delay *= 2
+	}
+	return min(delay, maxBackoff)
+}
@@ -0,0 +1,169 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"io"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"git.esd.cc/imlonghao/adif2cloud/pkg/ledger"
+	"git.esd.cc/imlonghao/adif2cloud/pkg/provider"
+)
+
+// fakeProvider 按记录内容返回预设的错误，并记下每次上传的记录
+type fakeProvider struct {
+	errs     map[string]error
+	uploaded []string
+}
+
+func (p *fakeProvider) GetSize(ctx context.Context) (int64, error)      { return 0, nil }
+func (p *fakeProvider) Download(ctx context.Context, w io.Writer) error { return nil }
+func (p *fakeProvider) GetName() string                                 { return "fake" }
+
+func (p *fakeProvider) Upload(ctx context.Context, filename, line string) error {
+	p.uploaded = append(p.uploaded, line)
+	return p.errs[line]
+}
+
+func TestWorkerDrain(t *testing.T) {
+	transient := errors.New("connection reset")
+	rejected := provider.Permanent(errors.New("qso rejected"))
+
+	tests := []struct {
+		name     string
+		queue    []string
+		attempts int
+		errs     map[string]error
+		wantWait bool
+		wantSent []string
+		wantLeft []string
+		// wantFailed 是账本中记为失败的记录
+		wantFailed []string
+	}{
+		{
+			name:     "uploads in order",
+			queue:    []string{"1", "2", "3"},
+			wantSent: []string{"1", "2", "3"},
+		},
+		{
+			name:       "transient error keeps the record at the head",
+			queue:      []string{"1", "2"},
+			errs:       map[string]error{"1": transient},
+			wantWait:   true,
+			wantSent:   []string{"1"},
+			wantLeft:   []string{"1", "2"},
+			wantFailed: []string{"1"},
+		},
+		{
+			name:       "permanent error parks the record",
+			queue:      []string{"1", "2"},
+			errs:       map[string]error{"1": rejected},
+			wantSent:   []string{"1", "2"},
+			wantFailed: []string{"1"},
+		},
+		{
+			name:       "4xx status is permanent",
+			queue:      []string{"1", "2"},
+			errs:       map[string]error{"1": provider.StatusError(400, "bad record")},
+			wantSent:   []string{"1", "2"},
+			wantFailed: []string{"1"},
+		},
+		{
+			name:       "rate limit is retried",
+			queue:      []string{"1", "2"},
+			errs:       map[string]error{"1": provider.StatusError(429, "")},
+			wantWait:   true,
+			wantSent:   []string{"1"},
+			wantLeft:   []string{"1", "2"},
+			wantFailed: []string{"1"},
+		},
+		{
+			name:       "gives up after too many attempts",
+			queue:      []string{"1", "2"},
+			attempts:   maxAttempts - 1,
+			errs:       map[string]error{"1": transient},
+			wantSent:   []string{"1", "2"},
+			wantFailed: []string{"1"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := openTest(t)
+			ledgerPath := filepath.Join(t.TempDir(), "ledger.jsonl")
+			l, err := ledger.Open(ledgerPath)
+			if err != nil {
+				t.Fatalf("ledger.Open() error = %v", err)
+			}
+			defer l.Close()
+			for _, line := range tt.queue {
+				o.Enqueue("t", Entry{Line: line, Attempts: tt.attempts})
+			}
+
+			p := &fakeProvider{errs: tt.errs}
+			w := NewWorker(context.Background(), o, Target{Name: "t", Provider: p}, l)
+			if wait := w.drain(); (wait > 0) != tt.wantWait {
+				t.Errorf("drain() = %v, want wait %v", wait, tt.wantWait)
+			}
+			if !slices.Equal(p.uploaded, tt.wantSent) {
+				t.Errorf("uploaded = %q, want %q", p.uploaded, tt.wantSent)
+			}
+			if got := lines(t, o, "t"); !slices.Equal(got, tt.wantLeft) {
+				t.Errorf("left in queue = %q, want %q", got, tt.wantLeft)
+			}
+
+			entries, err := ledger.Read(ledgerPath)
+			if err != nil {
+				t.Fatalf("ledger.Read() error = %v", err)
+			}
+			var failed []string
+			for _, e := range entries {
+				if e.Target != "t" {
+					t.Errorf("ledger entry target = %q, want t", e.Target)
+				}
+				if e.Outcome == ledger.Failed {
+					failed = append(failed, e.Record)
+				}
+			}
+			if !slices.Equal(failed, tt.wantFailed) {
+				t.Errorf("failed in ledger = %q, want %q", failed, tt.wantFailed)
+			}
+		})
+	}
+}
+
+func TestWorkerDrainCountsAttempts(t *testing.T) {
+	o := openTest(t)
+	o.Enqueue("t", Entry{Line: "1"})
+	p := &fakeProvider{errs: map[string]error{"1": errors.New("timeout")}}
+	w := NewWorker(context.Background(), o, Target{Name: "t", Provider: p}, nil)
+
+	first := w.drain()
+	second := w.drain()
+	if second <= first {
+		t.Errorf("backoff did not grow: %v then %v", first, second)
+	}
+	item, _ := o.Peek("t")
+	if item == nil || item.Attempts != 2 || item.LastErr != "timeout" {
+		t.Errorf("Peek() = %+v, want 2 attempts with the last error", item)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{1, minBackoff},
+		{2, 2 * minBackoff},
+		{3, 4 * minBackoff},
+		{100, maxBackoff},
+	}
+	for _, tt := range tests {
+		if got := backoff(tt.attempts); got != tt.want {
+			t.Errorf("backoff(%d) = %v, want %v", tt.attempts, got, tt.want)
+		}
+	}
+}
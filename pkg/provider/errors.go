@@ -0,0 +1,52 @@
+package provider
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// PermanentError 表示服务明确拒绝了这条记录，原样重试也不会成功，例如格式错误或被拒绝的 QSO
+type PermanentError struct {
+	Err error
+}
+
+func (e *PermanentError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *PermanentError) Unwrap() error {
+	return e.Err
+}
+
+// Permanent 把 err 标记为永久错误，err 为 nil 时返回 nil
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &PermanentError{Err: err}
+}
+
+// IsPermanent 判断 err 是否为永久错误
+func IsPermanent(err error) bool {
+	var pe *PermanentError
+	return errors.As(err, &pe)
+}
+
+// StatusError 返回非成功 HTTP 状态码对应的错误。4xx 表示请求本身被拒绝，是永久错误；
+// 认证失败、地址错误和限流在修改配置或稍后重试后可以恢复，仍按临时错误处理
+func StatusError(code int, body string) error {
+	err := fmt.Errorf("unexpected status code: %d", code)
+	if body != "" {
+		err = fmt.Errorf("unexpected status code: %d, body: %s", code, body)
+	}
+	switch code {
+	case http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound,
+		http.StatusProxyAuthRequired, http.StatusRequestTimeout, http.StatusTooManyRequests:
+		return err
+	}
+	if code >= 400 && code < 500 {
+		return Permanent(err)
+	}
+	return err
+}
@@ -1,20 +1,107 @@
 package provider
 
 import (
+	"context"
 	"io"
 )
 
-// Provider 定义了云存储提供商的接口
+// Provider 定义了云存储提供商的接口，ctx 被取消或超时时实现应尽快放弃正在进行的请求
 type Provider interface {
 	// GetSize 获取远程 ADIF 文件的大小
-	GetSize() (int64, error)
+	GetSize(ctx context.Context) (int64, error)
 
 	// Download 下载远程 ADIF 文件到本地
-	Download(w io.Writer) error
+	Download(ctx context.Context, w io.Writer) error
 
 	// Upload 上传文件或新增行到远程端
-	Upload(filename string, line string) error
+	Upload(ctx context.Context, filename string, line string) error
 
 	// GetName 获取提供商的名称
 	GetName() string
 }
+
+// BatchUploader 是可以在一次请求中上传多条记录的提供商实现的可选接口
+type BatchUploader interface {
+	// UploadBatch 上传多条 QSO 记录，返回与 lines 等长的结果，nil 表示该记录已被接受。
+	// 服务只返回整个请求的结果时，实现不能让被拒绝的记录连累同一请求中已经导入的记录，
+	// 例如改为逐条上传；无法区分时同一个请求中的记录共享同一个结果。实现需要自行按服务的限制拆分请求
+	UploadBatch(ctx context.Context, filename string, lines []string) []error
+}
+
+// FileUploader 是上传整个源文件、忽略 line 参数的提供商实现的可选接口，例如 S3 和 Git
+type FileUploader interface {
+	// UploadsFile 返回 true 表示 Upload 读取 filename 指向的整个文件
+	UploadsFile() bool
+}
+
+// UploadsFile 判断提供商是否上传整个源文件
+func UploadsFile(p Provider) bool {
+	fu, ok := p.(FileUploader)
+	return ok && fu.UploadsFile()
+}
+
+// UploadBatch 在提供商实现了 BatchUploader 时批量上传，否则逐条调用 Upload
+func UploadBatch(ctx context.Context, p Provider, filename string, lines []string) []error {
+	if b, ok := p.(BatchUploader); ok {
+		return b.UploadBatch(ctx, filename, lines)
+	}
+	return uploadEach(ctx, p, filename, lines)
+}
+
+// uploadEach 逐条调用 Upload，ctx 被取消后剩下的记录直接返回 ctx 的错误。
+// 上传整个源文件的提供商只上传一次，所有记录得到同一个结果
+func uploadEach(ctx context.Context, p Provider, filename string, lines []string) []error {
+	if UploadsFile(p) {
+		if len(lines) == 0 {
+			return nil
+		}
+		return Fill(len(lines), upload(ctx, p, filename, lines[len(lines)-1]))
+	}
+	errs := make([]error, len(lines))
+	for i, line := range lines {
+		if err := ctx.Err(); err != nil {
+			errs[i] = err
+			continue
+		}
+		errs[i] = upload(ctx, p, filename, line)
+	}
+	return errs
+}
+
+// upload 调用一次 Upload，超时单独计算
+func upload(ctx context.Context, p Provider, filename, line string) error {
+	ctx, cancel := RequestContext(ctx)
+	defer cancel()
+	return p.Upload(ctx, filename, line)
+}
+
+// Batches 按记录数和字节数上限切分记录，上限为 0 表示不限制。
+// 单条超过字节上限的记录单独成批
+func Batches(lines []string, maxRecords, maxBytes int) [][]string {
+	var batches [][]string
+	var current []string
+	size := 0
+	for _, line := range lines {
+		full := maxRecords > 0 && len(current) >= maxRecords
+		tooBig := maxBytes > 0 && len(current) > 0 && size+len(line) > maxBytes
+		if full || tooBig {
+			batches = append(batches, current)
+			current, size = nil, 0
+		}
+		current = append(current, line)
+		size += len(line)
+	}
+	if len(current) > 0 {
+		batches = append(batches, current)
+	}
+	return batches
+}
+
+// Fill 返回长度为 n、每项都是 err 的结果，用于整批请求失败的情况
+func Fill(n int, err error) []error {
+	errs := make([]error, n)
+	for i := range errs {
+		errs[i] = err
+	}
+	return errs
+}
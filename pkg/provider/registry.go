@@ -0,0 +1,150 @@
+package provider
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mitchellh/mapstructure"
+)
+
+// Factory 根据原始配置创建提供商
+type Factory func(options map[string]interface{}) (Provider, error)
+
+// ConfigError 表示目标配置本身有误，例如未知字段或缺少必填字段
+type ConfigError struct {
+	Type string
+	Err  error
+}
+
+func (e *ConfigError) Error() string {
+	return fmt.Sprintf("invalid %s config: %s", e.Type, e.Err)
+}
+
+func (e *ConfigError) Unwrap() error {
+	return e.Err
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   = make(map[string]Factory)
+)
+
+// Register 注册一种目标类型，cfg 是带 mapstructure 标签的配置结构体，
+// 带 `required:"true"` 标签的字段不能为空。
+// 通常在各提供商包的 init 中调用。
+func Register[T any](typ string, newFn func(cfg T) (Provider, error)) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if _, ok := registry[typ]; ok {
+		panic(fmt.Sprintf("provider: type %q registered twice", typ))
+	}
+	registry[typ] = func(options map[string]interface{}) (Provider, error) {
+		var cfg T
+		if err := Decode(options, &cfg); err != nil {
+			return nil, &ConfigError{Type: typ, Err: err}
+		}
+		return newFn(cfg)
+	}
+}
+
+// Types 返回所有已注册的目标类型
+func Types() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	types := make([]string, 0, len(registry))
+	for typ := range registry {
+		types = append(types, typ)
+	}
+	slices.Sort(types)
+	return types
+}
+
+// New 使用已注册的工厂创建指定类型的提供商
+func New(typ string, options map[string]interface{}) (Provider, error) {
+	registryMu.RLock()
+	factory, ok := registry[typ]
+	registryMu.RUnlock()
+	if !ok {
+		return nil, &ConfigError{
+			Type: typ,
+			Err:  fmt.Errorf("unknown target type, available types: %s", strings.Join(Types(), ", ")),
+		}
+	}
+	return factory(options)
+}
+
+// Decode 把原始配置严格解码到 out 指向的结构体中，
+// 未知字段和缺少的必填字段都会返回错误
+func Decode(options map[string]interface{}, out interface{}) error {
+	var md mapstructure.Metadata
+	decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		Metadata:         &md,
+		Result:           out,
+		WeaklyTypedInput: true,
+		DecodeHook: mapstructure.ComposeDecodeHookFunc(
+			mapstructure.StringToTimeDurationHookFunc(),
+			mapstructure.StringToSliceHookFunc(","),
+			dateToStringHook,
+		),
+	})
+	if err != nil {
+		return err
+	}
+	if err := decoder.Decode(options); err != nil {
+		return err
+	}
+	var errs []error
+	if len(md.Unused) > 0 {
+		slices.Sort(md.Unused)
+		errs = append(errs, fmt.Errorf("unknown field(s): %s", quoteAll(md.Unused)))
+	}
+	if missing := missingRequired(reflect.ValueOf(out)); len(missing) > 0 {
+		errs = append(errs, fmt.Errorf("missing required field(s): %s", quoteAll(missing)))
+	}
+	return errors.Join(errs...)
+}
+
+// dateToStringHook 把 YAML 中没有加引号、被解析为 time.Time 的日期转换回 YYYY-MM-DD 字符串
+func dateToStringHook(_ reflect.Type, to reflect.Type, data interface{}) (interface{}, error) {
+	if t, ok := data.(time.Time); ok && to.Kind() == reflect.String {
+		return t.Format("2006-01-02"), nil
+	}
+	return data, nil
+}
+
+// missingRequired 返回带 required 标签但值为空的字段名
+func missingRequired(v reflect.Value) []string {
+	for v.Kind() == reflect.Pointer {
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return nil
+	}
+	var missing []string
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.Tag.Get("required") != "true" || !v.Field(i).IsZero() {
+			continue
+		}
+		name, _, _ := strings.Cut(field.Tag.Get("mapstructure"), ",")
+		if name == "" {
+			name = field.Name
+		}
+		missing = append(missing, name)
+	}
+	return missing
+}
+
+func quoteAll(names []string) string {
+	quoted := make([]string, len(names))
+	for i, name := range names {
+		quoted[i] = fmt.Sprintf("%q", name)
+	}
+	return strings.Join(quoted, ", ")
+}
@@ -0,0 +1,65 @@
+package provider
+
+import (
+	"context"
+	"io"
+	"time"
+)
+
+// WithTimeout 返回一个为每次调用设置超时的提供商，timeout 不大于 0 时原样返回 p。
+// 批量上传会拆成多个请求，超时通过 ctx 交给提供商，由 RequestContext 为每个请求单独计时，
+// 不支持批量上传的提供商逐条计时
+func WithTimeout(p Provider, timeout time.Duration) Provider {
+	if timeout <= 0 {
+		return p
+	}
+	return &timeoutProvider{Provider: p, timeout: timeout}
+}
+
+type timeoutProvider struct {
+	Provider
+	timeout time.Duration
+}
+
+func (p *timeoutProvider) GetSize(ctx context.Context) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+	return p.Provider.GetSize(ctx)
+}
+
+func (p *timeoutProvider) Download(ctx context.Context, w io.Writer) error {
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+	return p.Provider.Download(ctx, w)
+}
+
+func (p *timeoutProvider) Upload(ctx context.Context, filename string, line string) error {
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+	return p.Provider.Upload(ctx, filename, line)
+}
+
+// UploadBatch 保留被包装提供商的批量上传能力
+func (p *timeoutProvider) UploadBatch(ctx context.Context, filename string, lines []string) []error {
+	b, ok := p.Provider.(BatchUploader)
+	if !ok {
+		return uploadEach(ctx, p, filename, lines)
+	}
+	return b.UploadBatch(context.WithValue(ctx, requestTimeoutKey{}, p.timeout), filename, lines)
+}
+
+type requestTimeoutKey struct{}
+
+// RequestContext 为批量上传中的一个请求设置 WithTimeout 的超时，
+// ctx 不是来自 WithTimeout 时只返回可以取消的 ctx
+func RequestContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if timeout, ok := ctx.Value(requestTimeoutKey{}).(time.Duration); ok {
+		return context.WithTimeout(ctx, timeout)
+	}
+	return context.WithCancel(ctx)
+}
+
+// UploadsFile 保留被包装提供商的 FileUploader 信息
+func (p *timeoutProvider) UploadsFile() bool {
+	return UploadsFile(p.Provider)
+}
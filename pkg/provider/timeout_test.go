@@ -0,0 +1,76 @@
+package provider
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+)
+
+// slowProvider 的每个请求都需要 delay 才能完成，ctx 先结束时返回 ctx 的错误
+type slowProvider struct {
+	delay time.Duration
+}
+
+func (p *slowProvider) GetSize(ctx context.Context) (int64, error)      { return 0, nil }
+func (p *slowProvider) Download(ctx context.Context, w io.Writer) error { return nil }
+func (p *slowProvider) GetName() string                                 { return "slow" }
+
+func (p *slowProvider) Upload(ctx context.Context, _ string, _ string) error {
+	select {
+	case <-time.After(p.delay):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// slowBatcher 像 Wavelog 和 Club Log 一样把一批记录拆成每条一个请求
+type slowBatcher struct {
+	slowProvider
+}
+
+func (p *slowBatcher) UploadBatch(ctx context.Context, filename string, lines []string) []error {
+	errs := make([]error, len(lines))
+	for i, line := range lines {
+		ctx, cancel := RequestContext(ctx)
+		errs[i] = p.Upload(ctx, filename, line)
+		cancel()
+	}
+	return errs
+}
+
+// passthrough 像转换步骤一样把批量上传交给被包装的提供商
+type passthrough struct {
+	Provider
+}
+
+func (p *passthrough) UploadBatch(ctx context.Context, filename string, lines []string) []error {
+	return UploadBatch(ctx, p.Provider, filename, lines)
+}
+
+func TestWithTimeoutPerRequest(t *testing.T) {
+	const delay = 30 * time.Millisecond
+	tests := []struct {
+		name    string
+		p       Provider
+		timeout time.Duration
+		wantErr bool
+	}{
+		{"batch requests are timed separately", &slowBatcher{slowProvider{delay: delay}}, 2 * delay, false},
+		{"single uploads are timed separately", &slowProvider{delay: delay}, 2 * delay, false},
+		{"single uploads behind a wrapper", &passthrough{&slowProvider{delay: delay}}, 2 * delay, false},
+		{"slow request still times out", &slowBatcher{slowProvider{delay: delay}}, delay / 3, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lines := []string{"a", "b", "c", "d"}
+			errs := UploadBatch(context.Background(), WithTimeout(tt.p, tt.timeout), "", lines)
+			for i, err := range errs {
+				if (err != nil) != tt.wantErr {
+					t.Errorf("record %d: error = %v, want error %v", i, err, tt.wantErr)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,110 @@
+package reconcile
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"git.esd.cc/imlonghao/adif2cloud/pkg/adif"
+)
+
+// Result 是本地与远程记录按 QSO 身份比较的结果，记录均为 ADI 格式
+type Result struct {
+	LocalOnly  []string
+	RemoteOnly []string
+	Common     int
+}
+
+// Compare 比较本地与远程的 ADI 或 ADX 内容
+func Compare(local, remote string) Result {
+	localRecords, localIDs := index(local)
+	remoteRecords, remoteIDs := index(remote)
+
+	localSet := make(map[string]bool, len(localIDs))
+	for _, id := range localIDs {
+		localSet[id] = true
+	}
+	remoteSet := make(map[string]bool, len(remoteIDs))
+	for _, id := range remoteIDs {
+		remoteSet[id] = true
+	}
+
+	var result Result
+	for i, record := range localRecords {
+		if remoteSet[localIDs[i]] {
+			result.Common++
+		} else {
+			result.LocalOnly = append(result.LocalOnly, record)
+		}
+	}
+	for i, record := range remoteRecords {
+		id := remoteIDs[i]
+		if localSet[id] {
+			continue
+		}
+		// 远程重复的记录只保留一条
+		localSet[id] = true
+		result.RemoteOnly = append(result.RemoteOnly, record)
+	}
+	return result
+}
+
+// index 切分日志内容并计算每条记录的 QSO 身份
+func index(data string) ([]string, []string) {
+	records := adif.SplitAny(data)
+	ids := make([]string, len(records))
+	for i, record := range records {
+		ids[i] = adif.Identity(adif.Parse(record))
+	}
+	return records, ids
+}
+
+// Merge 在本地内容末尾追加仅存在于远程的记录，本地原有内容保持不变。
+// 本地是 ADX 时整个文件按 ADX 格式重新写出
+func Merge(local string, remoteOnly []string) (string, error) {
+	if adif.IsADX(local) {
+		log, err := adif.ParseADX(local)
+		if err != nil {
+			return "", err
+		}
+		log.Records = append(log.Records, remoteOnly...)
+		var b strings.Builder
+		if err := log.WriteADX(&b, adif.Header{}); err != nil {
+			return "", err
+		}
+		return b.String(), nil
+	}
+
+	var b strings.Builder
+	b.WriteString(local)
+	if local != "" && !strings.HasSuffix(local, "\n") {
+		b.WriteString("\n")
+	}
+	for _, record := range remoteOnly {
+		b.WriteString(record)
+		b.WriteString("\n")
+	}
+	return b.String(), nil
+}
+
+// Backup 把文件复制到同目录下带时间戳的备份文件，返回备份文件路径
+func Backup(path string) (string, error) {
+	src, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to open file: %w", err)
+	}
+	defer src.Close()
+
+	backupPath := fmt.Sprintf("%s.%s.bak", path, time.Now().Format("20060102-150405"))
+	dst, err := os.OpenFile(backupPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return "", fmt.Errorf("failed to create backup file: %w", err)
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		return "", fmt.Errorf("failed to write backup file: %w", err)
+	}
+	return backupPath, dst.Close()
+}
@@ -8,6 +8,9 @@ import (
 	"log/slog"
 	"os"
 
+	"git.esd.cc/imlonghao/adif2cloud/pkg/adif"
+	"git.esd.cc/imlonghao/adif2cloud/pkg/provider"
+
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/credentials"
@@ -20,9 +23,17 @@ type S3Config struct {
 	Region          string `mapstructure:"region"`
 	AccessKeyID     string `mapstructure:"access_key_id"`
 	SecretAccessKey string `mapstructure:"secret_access_key"`
-	BucketName      string `mapstructure:"bucket_name"`
+	BucketName      string `mapstructure:"bucket_name" required:"true"`
 	UsePathStyle    bool   `mapstructure:"use_path_style"`
 	FileName        string `mapstructure:"file_name"`
+	// Format 是保存的日志格式，adi（默认）或 adx
+	Format string `mapstructure:"format"`
+}
+
+func init() {
+	provider.Register("s3", func(cfg S3Config) (provider.Provider, error) {
+		return NewS3Provider(cfg)
+	})
 }
 
 // S3Provider 实现了 Provider 接口，用于 S3 服务
@@ -30,12 +41,17 @@ type S3Provider struct {
 	client     *s3.Client
 	bucketName string
 	fileName   string
+	format     string
 }
 
 // NewS3Provider 创建一个新的 S3Provider 实例
 func NewS3Provider(cfg S3Config) (*S3Provider, error) {
 	slog.Debug("Creating S3 provider", "endpoint", cfg.Endpoint, "bucket", cfg.BucketName)
-	awsCfg, err := config.LoadDefaultConfig(context.TODO(),
+	format, err := adif.ParseFormat(cfg.Format)
+	if err != nil {
+		return nil, err
+	}
+	awsCfg, err := config.LoadDefaultConfig(context.Background(),
 		config.WithRegion(cfg.Region),
 		config.WithCredentialsProvider(credentials.NewStaticCredentialsProvider(cfg.AccessKeyID, cfg.SecretAccessKey, "")),
 		config.WithBaseEndpoint(cfg.Endpoint),
@@ -54,12 +70,13 @@ func NewS3Provider(cfg S3Config) (*S3Provider, error) {
 		client:     client,
 		bucketName: cfg.BucketName,
 		fileName:   cfg.FileName,
+		format:     format,
 	}, nil
 }
 
 // GetSize 获取 S3 上 ADIF 文件的大小
-func (p *S3Provider) GetSize() (int64, error) {
-	head, err := p.client.HeadObject(context.TODO(), &s3.HeadObjectInput{
+func (p *S3Provider) GetSize(ctx context.Context) (int64, error) {
+	head, err := p.client.HeadObject(ctx, &s3.HeadObjectInput{
 		Bucket: aws.String(p.bucketName),
 		Key:    aws.String(p.fileName),
 	})
@@ -70,8 +87,8 @@ func (p *S3Provider) GetSize() (int64, error) {
 }
 
 // Download 从 S3 下载 ADIF 文件
-func (p *S3Provider) Download(w io.Writer) error {
-	result, err := p.client.GetObject(context.TODO(), &s3.GetObjectInput{
+func (p *S3Provider) Download(ctx context.Context, w io.Writer) error {
+	result, err := p.client.GetObject(ctx, &s3.GetObjectInput{
 		Bucket: aws.String(p.bucketName),
 		Key:    aws.String(p.fileName),
 	})
@@ -84,14 +101,18 @@ func (p *S3Provider) Download(w io.Writer) error {
 	return err
 }
 
-// Upload 上传文件到 S3
-func (p *S3Provider) Upload(filename string, _ string) error {
+// Upload 把文件转换为配置的格式后上传到 S3
+func (p *S3Provider) Upload(ctx context.Context, filename string, _ string) error {
 	content, err := os.ReadFile(filename)
 	if err != nil {
 		return fmt.Errorf("failed to read file: %w", err)
 	}
+	content, err = adif.Convert(content, p.format)
+	if err != nil {
+		return fmt.Errorf("failed to convert file to %s: %w", p.format, err)
+	}
 
-	_, err = p.client.PutObject(context.TODO(), &s3.PutObjectInput{
+	_, err = p.client.PutObject(ctx, &s3.PutObjectInput{
 		Bucket: aws.String(p.bucketName),
 		Key:    aws.String(p.fileName),
 		Body:   bytes.NewReader(content),
@@ -99,6 +120,11 @@ func (p *S3Provider) Upload(filename string, _ string) error {
 	return err
 }
 
+// UploadsFile 表示 S3 上传的是整个源文件
+func (p *S3Provider) UploadsFile() bool {
+	return true
+}
+
 // GetName 获取提供商的名称
 func (p *S3Provider) GetName() string {
 	return fmt.Sprintf("S3->%s->%s", *p.client.Options().BaseEndpoint, p.bucketName)
@@ -0,0 +1,34 @@
+package source
+
+// Kind 表示来源中一条 QSO 记录的变化类型
+type Kind int
+
+const (
+	// Added 是新增的 QSO
+	Added Kind = iota
+	// Updated 是已有 QSO 的内容被修改
+	Updated
+	// Deleted 是已有 QSO 被删除
+	Deleted
+)
+
+func (k Kind) String() string {
+	switch k {
+	case Added:
+		return "added"
+	case Updated:
+		return "updated"
+	case Deleted:
+		return "deleted"
+	default:
+		return "unknown"
+	}
+}
+
+// Event 是来源上报的一次记录变化。Identity 是 adif.Identity 生成的 QSO 键，
+// Record 是 ADI 格式的记录，删除事件中可能为空
+type Event struct {
+	Kind     Kind
+	Identity string
+	Record   string
+}
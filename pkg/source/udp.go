@@ -0,0 +1,33 @@
+package source
+
+import (
+	"fmt"
+	"net"
+)
+
+// ListenUDP 监听 UDP 地址。地址为组播地址时加入该组播组，iface 是使用的网卡名称，为空时由系统选择
+func ListenUDP(listen, iface string) (*net.UDPConn, *net.UDPAddr, error) {
+	addr, err := net.ResolveUDPAddr("udp", listen)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid listen address: %w", err)
+	}
+	if !addr.IP.IsMulticast() {
+		conn, err := net.ListenUDP("udp", addr)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to listen: %w", err)
+		}
+		return conn, addr, nil
+	}
+
+	var ifi *net.Interface
+	if iface != "" {
+		if ifi, err = net.InterfaceByName(iface); err != nil {
+			return nil, nil, fmt.Errorf("invalid multicast interface: %w", err)
+		}
+	}
+	conn, err := net.ListenMulticastUDP("udp", ifi, addr)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to join multicast group: %w", err)
+	}
+	return conn, addr, nil
+}
@@ -0,0 +1,153 @@
+package transform
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"git.esd.cc/imlonghao/adif2cloud/pkg/adif"
+	"git.esd.cc/imlonghao/adif2cloud/pkg/provider"
+)
+
+// Wrap 返回在上传前先转换记录的提供商，pipeline 为 nil 时原样返回 p。
+// 上传整个文件的提供商（见 provider.FileUploader）收到的是所有记录都转换过的临时副本
+func Wrap(p provider.Provider, pipeline *Pipeline) provider.Provider {
+	if pipeline == nil {
+		return p
+	}
+	return &transformProvider{Provider: p, pipeline: pipeline, wholeFile: provider.UploadsFile(p)}
+}
+
+type transformProvider struct {
+	provider.Provider
+	pipeline  *Pipeline
+	wholeFile bool
+}
+
+func (p *transformProvider) Upload(ctx context.Context, filename string, line string) error {
+	if p.wholeFile {
+		tmp, err := p.transformFile(filename)
+		if err != nil {
+			return err
+		}
+		defer os.Remove(tmp)
+		filename = tmp
+	}
+	line, err := p.record(line)
+	if err != nil {
+		return err
+	}
+	return p.Provider.Upload(ctx, filename, line)
+}
+
+// UploadsFile 保留被包装提供商的 FileUploader 信息
+func (p *transformProvider) UploadsFile() bool {
+	return p.wholeFile
+}
+
+// UploadBatch 保留被包装提供商的批量上传能力，转换失败的记录不会被上传
+func (p *transformProvider) UploadBatch(ctx context.Context, filename string, lines []string) []error {
+	errs := make([]error, len(lines))
+	if p.wholeFile {
+		tmp, err := p.transformFile(filename)
+		if err != nil {
+			return provider.Fill(len(lines), err)
+		}
+		defer os.Remove(tmp)
+		filename = tmp
+	}
+
+	var index []int
+	var transformed []string
+	for i, line := range lines {
+		record, err := p.record(line)
+		if err != nil {
+			errs[i] = err
+			continue
+		}
+		index = append(index, i)
+		transformed = append(transformed, record)
+	}
+	for j, err := range provider.UploadBatch(ctx, p.Provider, filename, transformed) {
+		errs[index[j]] = err
+	}
+	return errs
+}
+
+// record 转换一条 ADI 记录并重新序列化
+func (p *transformProvider) record(line string) (string, error) {
+	fields, err := p.pipeline.Apply(adif.Parse(line))
+	if err != nil {
+		return "", fmt.Errorf("failed to transform record: %w", err)
+	}
+	record, err := adif.FormatRecord(fields)
+	if err != nil {
+		return "", fmt.Errorf("failed to write transformed record: %w", err)
+	}
+	return record, nil
+}
+
+// transformFile 把源文件中的每条记录转换后写入同格式的临时文件，返回临时文件路径
+func (p *transformProvider) transformFile(filename string) (string, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return "", fmt.Errorf("failed to read file: %w", err)
+	}
+	var b strings.Builder
+	content := string(data)
+	if adif.IsADX(content) {
+		if err := p.transformADX(&b, content); err != nil {
+			return "", err
+		}
+	} else if err := p.transformADI(&b, content); err != nil {
+		return "", err
+	}
+
+	tmp, err := os.CreateTemp("", "adif2cloud-*"+filepath.Ext(filename))
+	if err != nil {
+		return "", fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	if _, err := tmp.WriteString(b.String()); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return "", fmt.Errorf("failed to write temporary file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return "", fmt.Errorf("failed to write temporary file: %w", err)
+	}
+	return tmp.Name(), nil
+}
+
+// transformADI 转换 ADI 内容中的每条记录，保留原来的文件头
+func (p *transformProvider) transformADI(b *strings.Builder, content string) error {
+	if i := strings.Index(strings.ToLower(content), "<eoh>"); i >= 0 {
+		b.WriteString(content[:i+len("<eoh>")])
+		b.WriteString("\n")
+	}
+	for _, line := range adif.Split(content) {
+		record, err := p.record(line)
+		if err != nil {
+			return err
+		}
+		b.WriteString(record)
+		b.WriteString("\n")
+	}
+	return nil
+}
+
+// transformADX 转换 ADX 内容中的每条记录并重新写出为 ADX
+func (p *transformProvider) transformADX(b *strings.Builder, content string) error {
+	log, err := adif.ParseADX(content)
+	if err != nil {
+		return fmt.Errorf("failed to read file: %w", err)
+	}
+	for i, line := range log.Records {
+		if log.Records[i], err = p.record(line); err != nil {
+			return err
+		}
+	}
+	return log.WriteADX(b, adif.Header{})
+}
@@ -0,0 +1,221 @@
+package transform
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"maps"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+	"text/template"
+)
+
+// Step 是 transform 列表中的一步，每一步只能设置一种操作，字段名不区分大小写
+type Step struct {
+	// Set 设置字段的值，已有的值会被覆盖
+	Set map[string]string `mapstructure:"set"`
+	// Default 只在字段缺少或为空时设置
+	Default map[string]string `mapstructure:"default"`
+	// Rename 把字段改名，键为旧名称，值为新名称
+	Rename map[string]string `mapstructure:"rename"`
+	// Delete 删除字段，支持 app_* 这样的通配符
+	Delete []string `mapstructure:"delete"`
+	// Uppercase 把字段的值转换为大写
+	Uppercase []string `mapstructure:"uppercase"`
+	// Replace 对字段的值做正则替换
+	Replace *Replace `mapstructure:"replace"`
+	// Template 用 text/template 根据其他字段生成字段，例如 "{{.call}} {{.band}}"
+	Template map[string]string `mapstructure:"template"`
+}
+
+// Replace 是正则替换操作，With 中可以使用 $1 引用分组
+type Replace struct {
+	Field string `mapstructure:"field"`
+	Regex string `mapstructure:"regex"`
+	With  string `mapstructure:"with"`
+}
+
+// Pipeline 是编译后的 transform 列表，nil 表示不修改记录
+type Pipeline struct {
+	steps []func(fields map[string]string) error
+}
+
+// Compile 检查并编译 transform 列表，列表为空时返回 nil
+func Compile(steps []Step) (*Pipeline, error) {
+	if len(steps) == 0 {
+		return nil, nil
+	}
+	var p Pipeline
+	var errs []error
+	for i, step := range steps {
+		fn, err := compile(step)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("transform[%d]: %w", i, err))
+			continue
+		}
+		p.steps = append(p.steps, fn)
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+func compile(step Step) (func(map[string]string) error, error) {
+	var ops []string
+	if step.Set != nil {
+		ops = append(ops, "set")
+	}
+	if step.Default != nil {
+		ops = append(ops, "default")
+	}
+	if step.Rename != nil {
+		ops = append(ops, "rename")
+	}
+	if step.Delete != nil {
+		ops = append(ops, "delete")
+	}
+	if step.Uppercase != nil {
+		ops = append(ops, "uppercase")
+	}
+	if step.Replace != nil {
+		ops = append(ops, "replace")
+	}
+	if step.Template != nil {
+		ops = append(ops, "template")
+	}
+	if len(ops) != 1 {
+		return nil, fmt.Errorf("each step needs exactly one of set, default, rename, delete, uppercase, replace or template, got %d", len(ops))
+	}
+
+	switch ops[0] {
+	case "set":
+		values := lowerKeys(step.Set)
+		return func(fields map[string]string) error {
+			maps.Copy(fields, values)
+			return nil
+		}, nil
+	case "default":
+		values := lowerKeys(step.Default)
+		return func(fields map[string]string) error {
+			for name, value := range values {
+				if strings.TrimSpace(fields[name]) == "" {
+					fields[name] = value
+				}
+			}
+			return nil
+		}, nil
+	case "rename":
+		names := lowerKeys(step.Rename)
+		for from, to := range names {
+			names[from] = strings.ToLower(to)
+		}
+		return func(fields map[string]string) error {
+			for from, to := range names {
+				if value, ok := fields[from]; ok {
+					delete(fields, from)
+					fields[to] = value
+				}
+			}
+			return nil
+		}, nil
+	case "delete":
+		patterns := lowerAll(step.Delete)
+		for _, pattern := range patterns {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("invalid delete pattern %q: %w", pattern, err)
+			}
+		}
+		return func(fields map[string]string) error {
+			for name := range fields {
+				if slices.ContainsFunc(patterns, func(pattern string) bool {
+					ok, _ := path.Match(pattern, name)
+					return ok
+				}) {
+					delete(fields, name)
+				}
+			}
+			return nil
+		}, nil
+	case "uppercase":
+		names := lowerAll(step.Uppercase)
+		return func(fields map[string]string) error {
+			for _, name := range names {
+				if value, ok := fields[name]; ok {
+					fields[name] = strings.ToUpper(value)
+				}
+			}
+			return nil
+		}, nil
+	case "replace":
+		field := strings.ToLower(strings.TrimSpace(step.Replace.Field))
+		if field == "" {
+			return nil, fmt.Errorf("replace: missing required field \"field\"")
+		}
+		re, err := regexp.Compile(step.Replace.Regex)
+		if err != nil {
+			return nil, fmt.Errorf("replace: invalid regex: %w", err)
+		}
+		with := step.Replace.With
+		return func(fields map[string]string) error {
+			if value, ok := fields[field]; ok {
+				fields[field] = re.ReplaceAllString(value, with)
+			}
+			return nil
+		}, nil
+	default:
+		templates := make(map[string]*template.Template, len(step.Template))
+		for name, text := range step.Template {
+			tmpl, err := template.New(name).Option("missingkey=zero").Parse(text)
+			if err != nil {
+				return nil, fmt.Errorf("template for %q: %w", name, err)
+			}
+			templates[strings.ToLower(name)] = tmpl
+		}
+		return func(fields map[string]string) error {
+			// 所有模板都使用这一步之前的字段，互不影响
+			data := maps.Clone(fields)
+			for name, tmpl := range templates {
+				var b bytes.Buffer
+				if err := tmpl.Execute(&b, data); err != nil {
+					return fmt.Errorf("template for %q: %w", name, err)
+				}
+				fields[name] = b.String()
+			}
+			return nil
+		}, nil
+	}
+}
+
+// Apply 依次执行每一步，返回修改后的字段副本，不包含 raw
+func (p *Pipeline) Apply(fields map[string]string) (map[string]string, error) {
+	out := maps.Clone(fields)
+	delete(out, "raw")
+	if p == nil {
+		return out, nil
+	}
+	for _, step := range p.steps {
+		if err := step(out); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+func lowerKeys(m map[string]string) map[string]string {
+	out := make(map[string]string, len(m))
+	for k, v := range m {
+		out[strings.ToLower(strings.TrimSpace(k))] = v
+	}
+	return out
+}
+
+func lowerAll(names []string) []string {
+	out := make([]string, len(names))
+	for i, name := range names {
+		out[i] = strings.ToLower(strings.TrimSpace(name))
+	}
+	return out
+}
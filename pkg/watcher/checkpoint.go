@@ -0,0 +1,133 @@
+package watcher
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"git.esd.cc/imlonghao/adif2cloud/pkg/adif"
+)
+
+// hashWindow 是计算文件指纹时读取的、位于偏移量之前的字节数
+const hashWindow = 4096
+
+// Checkpoint 记录源文件已经处理到的位置以及文件的身份信息
+type Checkpoint struct {
+	Path   string `json:"path"`
+	Offset int64  `json:"offset"`
+	FileID uint64 `json:"file_id"`
+	Hash   string `json:"hash"`
+	// Records 是 offset 之前记录的 QSO 身份及内容指纹，用于文件被改写后比较差异
+	Records map[string]string `json:"records,omitempty"`
+}
+
+// CheckpointPath 返回某个源文件在状态目录中的检查点文件路径
+func CheckpointPath(stateDir, source string) string {
+	if abs, err := filepath.Abs(source); err == nil {
+		source = abs
+	}
+	sum := sha1.Sum([]byte(source))
+	return filepath.Join(stateDir, "checkpoint-"+hex.EncodeToString(sum[:6])+".json")
+}
+
+func loadCheckpoint(path string) (*Checkpoint, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var c Checkpoint
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("failed to parse checkpoint: %w", err)
+	}
+	return &c, nil
+}
+
+// Remember 把记录加入检查点中已知记录的集合，
+// 用于程序自己改写了源文件（例如合并远程记录）之后，避免这些记录被当作新 QSO 上报
+func Remember(statePath string, records []string) error {
+	checkpoint, err := loadCheckpoint(statePath)
+	if err != nil || checkpoint == nil {
+		// 没有检查点时，首次运行会把文件中已有的记录全部视为已知
+		return err
+	}
+	if checkpoint.Records == nil {
+		checkpoint.Records = make(map[string]string)
+	}
+	for _, record := range records {
+		fields := adif.Parse(record)
+		checkpoint.Records[adif.Identity(fields)] = adif.Fingerprint(fields)
+	}
+	return checkpoint.save(statePath)
+}
+
+// save 先写临时文件再重命名，避免崩溃时留下半个检查点
+func (c *Checkpoint) save(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	data, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// newCheckpoint 为 filePath 当前的 offset 生成检查点
+func newCheckpoint(filePath string, offset int64) (*Checkpoint, error) {
+	fi, err := os.Stat(filePath)
+	if err != nil {
+		return nil, err
+	}
+	hash, err := prefixHash(filePath, offset)
+	if err != nil {
+		return nil, err
+	}
+	return &Checkpoint{
+		Path:   filePath,
+		Offset: offset,
+		FileID: fileID(fi),
+		Hash:   hash,
+	}, nil
+}
+
+// matches 判断文件是否仍然是检查点记录时的那个文件，并且 offset 之前的内容没有被改写
+func (c *Checkpoint) matches(filePath string) bool {
+	fi, err := os.Stat(filePath)
+	if err != nil || fi.Size() < c.Offset {
+		return false
+	}
+	if id := fileID(fi); id != 0 && c.FileID != 0 && id != c.FileID {
+		return false
+	}
+	hash, err := prefixHash(filePath, c.Offset)
+	return err == nil && hash == c.Hash
+}
+
+// prefixHash 计算 offset 之前最多 hashWindow 字节内容的 SHA-256
+func prefixHash(filePath string, offset int64) (string, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	start := max(offset-hashWindow, 0)
+	h := sha256.New()
+	if _, err := io.Copy(h, io.NewSectionReader(f, start, offset-start)); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,16 @@
+//go:build !windows
+
+package watcher
+
+import (
+	"os"
+	"syscall"
+)
+
+// fileID 返回文件的 inode，用于判断文件是否被替换
+func fileID(fi os.FileInfo) uint64 {
+	if st, ok := fi.Sys().(*syscall.Stat_t); ok {
+		return uint64(st.Ino)
+	}
+	return 0
+}
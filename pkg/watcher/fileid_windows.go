@@ -0,0 +1,10 @@
+//go:build windows
+
+package watcher
+
+import "os"
+
+// fileID 在 Windows 上无法从 FileInfo 取得文件编号，只依赖内容指纹判断
+func fileID(_ os.FileInfo) uint64 {
+	return 0
+}
@@ -0,0 +1,162 @@
+package watcher
+
+import (
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"git.esd.cc/imlonghao/adif2cloud/pkg/source"
+)
+
+// globInterval 是检查是否有新文件匹配 glob 的间隔
+const globInterval = 10 * time.Second
+
+// Group 为每个匹配 patterns 的文件创建一个 ADIWatcher，并定期检查新出现的文件。
+// 同一个文件匹配多个 pattern 时只属于第一个。启动时已有的文件从检查点继续，
+// 运行中新出现的文件从头读取，其中的记录都会上报
+type Group struct {
+	stateDir string
+	patterns []string
+	callback func(pattern int, filename string, event source.Event)
+
+	mu       sync.Mutex
+	watchers map[string]*ADIWatcher
+
+	started bool
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+// Glob 返回每个 pattern 当前匹配的文件，文件路径为绝对路径，同一个文件只出现在第一个匹配它的 pattern 中
+func Glob(patterns []string) ([][]string, error) {
+	seen := make(map[string]bool)
+	files := make([][]string, len(patterns))
+	for i, pattern := range patterns {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid source pattern %q: %w", pattern, err)
+		}
+		for _, match := range matches {
+			if abs, err := filepath.Abs(match); err == nil {
+				match = abs
+			}
+			if !seen[match] {
+				seen[match] = true
+				files[i] = append(files[i], match)
+			}
+		}
+	}
+	return files, nil
+}
+
+// NewGroup 为 patterns 当前匹配的文件创建监视器，callback 收到的 pattern 是文件所属 pattern 的下标
+func NewGroup(stateDir string, patterns []string, callback func(pattern int, filename string, event source.Event)) (*Group, error) {
+	g := &Group{
+		stateDir: stateDir,
+		patterns: patterns,
+		callback: callback,
+		watchers: make(map[string]*ADIWatcher),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	files, err := Glob(patterns)
+	if err != nil {
+		return nil, err
+	}
+	for i, matches := range files {
+		if len(matches) == 0 {
+			slog.Info("No file matches source pattern yet", "pattern", patterns[i])
+		}
+		for _, file := range matches {
+			if err := g.add(i, file, false); err != nil {
+				g.Close()
+				return nil, err
+			}
+		}
+	}
+	return g, nil
+}
+
+func (g *Group) add(pattern int, file string, fromStart bool) error {
+	w, err := newADIWatcher(file, CheckpointPath(g.stateDir, file), func(event source.Event) {
+		g.callback(pattern, file, event)
+	}, fromStart)
+	if err != nil {
+		return fmt.Errorf("%s: %w", file, err)
+	}
+	if g.started {
+		if err := w.Start(); err != nil {
+			w.Close()
+			return fmt.Errorf("%s: %w", file, err)
+		}
+	}
+	g.watchers[file] = w
+	return nil
+}
+
+// Files 返回正在监视的文件数
+func (g *Group) Files() int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return len(g.watchers)
+}
+
+func (g *Group) Start() error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.started = true
+	for _, w := range g.watchers {
+		if err := w.Start(); err != nil {
+			return err
+		}
+	}
+	go g.watch()
+	return nil
+}
+
+// watch 定期检查是否有新文件匹配 patterns
+func (g *Group) watch() {
+	defer close(g.done)
+	ticker := time.NewTicker(globInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-g.stop:
+			return
+		case <-ticker.C:
+		}
+		files, err := Glob(g.patterns)
+		if err != nil {
+			slog.Warn("Failed to match source patterns", "error", err)
+			continue
+		}
+		g.mu.Lock()
+		for i, matches := range files {
+			for _, file := range matches {
+				if g.watchers[file] != nil {
+					continue
+				}
+				slog.Info("Found new source file", "pattern", g.patterns[i], "file_path", file)
+				if err := g.add(i, file, true); err != nil {
+					// 文件可能还没写完，下一次检查时重试
+					slog.Warn("Failed to watch new source file", "file_path", file, "error", err)
+				}
+			}
+		}
+		g.mu.Unlock()
+	}
+}
+
+func (g *Group) Close() {
+	close(g.stop)
+	if g.started {
+		<-g.done
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for _, w := range g.watchers {
+		w.Close()
+	}
+}
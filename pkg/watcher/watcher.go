@@ -1,68 +1,348 @@
 package watcher
 
 import (
+	"errors"
 	"io"
 	"log/slog"
+	"os"
+	"path/filepath"
 	"strings"
+	"time"
 
-	"github.com/nxadm/tail"
+	"git.esd.cc/imlonghao/adif2cloud/pkg/adif"
+	"git.esd.cc/imlonghao/adif2cloud/pkg/source"
 )
 
+// pollInterval 是检查源文件变化的间隔
+const pollInterval = time.Second
+
+// ADIWatcher 监视一个 ADI 文件。追加的记录按顺序上报；
+// 文件被整体改写（临时文件重命名覆盖、编辑后重写、截断）时，
+// 会把新文件中的记录与上次已知的记录按 QSO 身份比较，只上报真正新增的记录，
+// 被修改或删除的记录作为单独的事件上报。
+// 扩展名为 .adx 的文件按 ADX 格式读取，每次变化都完整比较。
 type ADIWatcher struct {
-	filePath string
-	tailer   *tail.Tail
-	callback func(string)
+	filePath  string
+	statePath string
+	callback  func(source.Event)
+	adx       bool
+	// fromStart 为 true 时没有检查点的文件从头读取，已有的记录全部上报
+	fromStart bool
+
+	// offset 是已处理到的最后一个记录边界，read 是已经读入 scanner 的字节数
+	offset  int64
+	read    int64
+	hash    string
+	fileID  uint64
+	modTime time.Time
+	// size 是上一次检查时的文件大小，与 modTime 一起判断文件是否还在被写入
+	size int64
+	// known 保存文件中已知记录的 QSO 身份及其内容指纹
+	known   map[string]string
+	scanner *adif.Scanner
+	// rescan 为 true 时下一次检查会完整比较文件
+	rescan bool
+
+	started bool
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+// NewADIWatcher 创建文件监视器。statePath 不为空时，会从上次保存的检查点继续读取；
+// 如果文件在此期间被改写或截断，则与检查点中记录的已知记录比较。
+func NewADIWatcher(filePath, statePath string, callback func(source.Event)) (*ADIWatcher, error) {
+	return newADIWatcher(filePath, statePath, callback, false)
 }
 
-func NewADIWatcher(filePath string, callback func(string)) (*ADIWatcher, error) {
+func newADIWatcher(filePath, statePath string, callback func(source.Event), fromStart bool) (*ADIWatcher, error) {
 	slog.Info("Creating ADI file watcher", "file_path", filePath)
-	t, err := tail.TailFile(filePath, tail.Config{
-		Location: &tail.SeekInfo{
-			Whence: io.SeekEnd,
-		},
-		Follow: true,
-	})
+	w := &ADIWatcher{
+		filePath:  filePath,
+		statePath: statePath,
+		callback:  callback,
+		adx:       strings.EqualFold(filepath.Ext(filePath), ".adx"),
+		fromStart: fromStart,
+		known:     make(map[string]string),
+		scanner:   adif.NewScanner(),
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+	if err := w.init(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// init 根据检查点决定从哪里开始读取
+func (w *ADIWatcher) init() error {
+	fi, err := os.Stat(w.filePath)
+	if err != nil {
+		return err
+	}
+	w.fileID = fileID(fi)
+	w.modTime = fi.ModTime()
+	w.size = fi.Size()
+
+	var checkpoint *Checkpoint
+	if w.statePath != "" {
+		checkpoint, err = loadCheckpoint(w.statePath)
+		if err != nil {
+			slog.Warn("Failed to load watcher checkpoint, starting from end of file", "path", w.statePath, "error", err)
+		}
+	}
+
+	switch {
+	case checkpoint == nil && w.fromStart:
+		slog.Info("New source file, reading from the beginning", "file_path", w.filePath)
+		w.rescan = true
+	case checkpoint == nil:
+		// 首次运行，不上传已有的记录
+		if err := w.load(); err != nil {
+			return err
+		}
+		w.save()
+	case checkpoint.matches(w.filePath):
+		slog.Info("Resuming from checkpoint", "file_path", w.filePath, "offset", checkpoint.Offset)
+		w.offset = checkpoint.Offset
+		w.read = checkpoint.Offset
+		w.hash = checkpoint.Hash
+		if checkpoint.Records != nil {
+			w.known = checkpoint.Records
+		}
+	default:
+		slog.Warn("Source file was rewritten since last run, comparing records with the last known set",
+			"file_path", w.filePath,
+			"known_records", len(checkpoint.Records))
+		if checkpoint.Records != nil {
+			w.known = checkpoint.Records
+		}
+		w.rescan = true
+	}
+	return nil
+}
+
+// load 读取整个文件并记住其中所有的记录，不上报任何事件
+func (w *ADIWatcher) load() error {
+	records, err := w.readAll()
+	if err != nil {
+		return err
+	}
+	for _, fields := range records {
+		w.known[adif.Identity(fields)] = adif.Fingerprint(fields)
+	}
+	return nil
+}
+
+// readAll 读取整个文件，重置 scanner 并更新读取位置，返回按顺序排列的记录
+func (w *ADIWatcher) readAll() ([]map[string]string, error) {
+	data, err := os.ReadFile(w.filePath)
 	if err != nil {
 		return nil, err
 	}
-	return &ADIWatcher{
-		filePath: filePath,
-		tailer:   t,
-		callback: callback,
-	}, nil
+	if w.adx {
+		return w.readADX(data)
+	}
+	w.scanner = adif.NewScanner()
+	w.scanner.Write(data)
+	var records []map[string]string
+	for {
+		record, ok := w.scanner.Next()
+		if !ok {
+			break
+		}
+		records = append(records, adif.Parse(record))
+	}
+	w.read = int64(len(data))
+	w.offset = w.read - int64(w.scanner.Buffered())
+	return records, nil
+}
+
+// readADX 解析整个 ADX 文件，XML 没有记录边界可以续读，读取位置总是文件末尾
+func (w *ADIWatcher) readADX(data []byte) ([]map[string]string, error) {
+	log, err := adif.ParseADX(string(data))
+	if err != nil {
+		// 文件可能正在被写入，等下一次检查
+		return nil, err
+	}
+	records := make([]map[string]string, len(log.Records))
+	for i, record := range log.Records {
+		records[i] = adif.Parse(record)
+	}
+	w.read = int64(len(data))
+	w.offset = w.read
+	return records, nil
+}
+
+func (w *ADIWatcher) save() {
+	checkpoint, err := newCheckpoint(w.filePath, w.offset)
+	if err != nil {
+		slog.Warn("Failed to compute watcher checkpoint", "file_path", w.filePath, "error", err)
+		return
+	}
+	w.hash = checkpoint.Hash
+	if w.statePath == "" {
+		return
+	}
+	checkpoint.Records = w.known
+	if err := checkpoint.save(w.statePath); err != nil {
+		slog.Warn("Failed to save watcher checkpoint", "path", w.statePath, "error", err)
+	}
 }
 
 func (w *ADIWatcher) Start() error {
 	slog.Info("Starting file monitoring", "file_path", w.filePath)
+	w.started = true
 	go w.watch()
 	return nil
 }
 
 func (w *ADIWatcher) watch() {
-	cache := ""
-	var offset int64
-	for line := range w.tailer.Lines {
-		if line.SeekInfo.Offset <= offset {
-			w.tailer.Stop()
-			w.tailer, _ = tail.TailFile(w.filePath, tail.Config{
-				Location: &tail.SeekInfo{
-					Whence: io.SeekEnd,
-				},
-				Follow: true,
-			})
-			go w.watch()
+	defer close(w.done)
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	for {
+		w.poll()
+		select {
+		case <-w.stop:
 			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// poll 检查文件的变化并上报新的记录
+func (w *ADIWatcher) poll() {
+	fi, err := os.Stat(w.filePath)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			slog.Warn("Failed to stat source file", "file_path", w.filePath, "error", err)
 		}
-		offset = line.SeekInfo.Offset
-		cache += line.Text
-		if strings.Contains(cache, "<eor>") {
-			w.callback(cache)
-			cache = ""
+		// 文件可能正在被替换，等下一次检查
+		return
+	}
+
+	id := fileID(fi)
+	replaced := id != 0 && w.fileID != 0 && id != w.fileID
+	modified := !fi.ModTime().Equal(w.modTime)
+	// 大小和修改时间与上一次检查相同时，文件没有正在被写入
+	stable := !modified && fi.Size() == w.size
+	w.fileID = id
+	w.modTime = fi.ModTime()
+	w.size = fi.Size()
+
+	switch {
+	case w.rescan || replaced || fi.Size() < w.read:
+		w.reconcileStable(stable)
+	case w.adx:
+		// ADX 追加记录时会改写结尾的 </RECORDS></ADX>，只能完整比较
+		if modified || fi.Size() != w.read {
+			w.reconcileStable(stable)
+		}
+	case fi.Size() > w.read:
+		if hash, err := prefixHash(w.filePath, w.offset); err != nil || hash != w.hash {
+			w.reconcileStable(stable)
+			return
 		}
+		w.readAppended(fi.Size())
+	case modified:
+		// 大小不变但内容可能在原地被修改
+		w.reconcileStable(stable)
 	}
 }
 
+// reconcileStable 在文件停止变化后才完整比较。原地改写文件（先截断再写入）的程序
+// 可能在写到一半时被检查到，这时比较会把还没写入的记录当作删除，写完后又当作新增重复上传
+func (w *ADIWatcher) reconcileStable(stable bool) {
+	if !stable {
+		slog.Debug("Source file is still changing, comparing records on next check", "file_path", w.filePath)
+		w.rescan = true
+		return
+	}
+	w.reconcile()
+}
+
+// readAppended 读取追加到文件末尾的数据
+func (w *ADIWatcher) readAppended(size int64) {
+	f, err := os.Open(w.filePath)
+	if err != nil {
+		slog.Warn("Failed to open source file", "file_path", w.filePath, "error", err)
+		return
+	}
+	defer f.Close()
+	if _, err := io.Copy(w.scanner, io.NewSectionReader(f, w.read, size-w.read)); err != nil {
+		slog.Warn("Failed to read source file", "file_path", w.filePath, "error", err)
+		return
+	}
+	w.read = size
+
+	emitted := false
+	for {
+		record, ok := w.scanner.Next()
+		if !ok {
+			break
+		}
+		fields := adif.Parse(record)
+		identity := adif.Identity(fields)
+		fingerprint := adif.Fingerprint(fields)
+		previous, seen := w.known[identity]
+		w.known[identity] = fingerprint
+		switch {
+		case !seen:
+			w.callback(source.Event{Kind: source.Added, Identity: identity, Record: record})
+		case previous != fingerprint:
+			w.callback(source.Event{Kind: source.Updated, Identity: identity, Record: record})
+		default:
+			slog.Debug("Skipping record that is already known", "file_path", w.filePath, "identity", identity)
+		}
+		emitted = true
+	}
+	// 只在记录边界保存检查点，避免重启后丢失半条记录
+	if emitted {
+		w.offset = w.read - int64(w.scanner.Buffered())
+		w.save()
+	}
+}
+
+// reconcile 重新读取整个文件，与已知的记录比较并上报差异
+func (w *ADIWatcher) reconcile() {
+	w.rescan = false
+	records, err := w.readAll()
+	if err != nil {
+		slog.Warn("Failed to read rewritten source file", "file_path", w.filePath, "error", err)
+		w.rescan = true
+		return
+	}
+	slog.Info("Source file was rewritten, comparing records", "file_path", w.filePath, "records", len(records))
+
+	current := make(map[string]string, len(records))
+	for _, fields := range records {
+		identity := adif.Identity(fields)
+		fingerprint := adif.Fingerprint(fields)
+		if _, dup := current[identity]; dup {
+			continue
+		}
+		current[identity] = fingerprint
+		previous, seen := w.known[identity]
+		switch {
+		case !seen:
+			w.callback(source.Event{Kind: source.Added, Identity: identity, Record: fields["raw"]})
+		case previous != fingerprint:
+			w.callback(source.Event{Kind: source.Updated, Identity: identity, Record: fields["raw"]})
+		}
+	}
+	for identity := range w.known {
+		if _, ok := current[identity]; !ok {
+			w.callback(source.Event{Kind: source.Deleted, Identity: identity})
+		}
+	}
+	w.known = current
+	w.save()
+}
+
 func (w *ADIWatcher) Close() {
 	slog.Info("Closing file watcher", "file_path", w.filePath)
-	w.tailer.Cleanup()
+	close(w.stop)
+	if w.started {
+		<-w.done
+	}
 }
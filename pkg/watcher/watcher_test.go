@@ -0,0 +1,218 @@
+package watcher
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"git.esd.cc/imlonghao/adif2cloud/pkg/source"
+)
+
+const header = "Exported log\n<ADIF_VER:5>3.1.4 <EOH>\n"
+
+func record(call, comment string) string {
+	return fmt.Sprintf("<CALL:%d>%s<QSO_DATE:8>20240601<TIME_ON:4>1200<BAND:3>20m<MODE:2>CW<COMMENT:%d>%s<EOR>\n",
+		len(call), call, len(comment), comment)
+}
+
+// testFile 是被监视的临时源文件。每次写入都把修改时间往后推，
+// 这样不依赖文件系统的时间精度也能判断文件是否还在变化
+type testFile struct {
+	t       *testing.T
+	path    string
+	state   string
+	modTime time.Time
+	events  []string
+}
+
+func newTestFile(t *testing.T, name, content string) *testFile {
+	dir := t.TempDir()
+	f := &testFile{
+		t:       t,
+		path:    filepath.Join(dir, name),
+		state:   filepath.Join(dir, "state", "checkpoint.json"),
+		modTime: time.Now().Add(-time.Hour),
+	}
+	f.write(content)
+	return f
+}
+
+func (f *testFile) touch(path string) {
+	f.t.Helper()
+	f.modTime = f.modTime.Add(time.Second)
+	if err := os.Chtimes(path, f.modTime, f.modTime); err != nil {
+		f.t.Fatal(err)
+	}
+}
+
+func (f *testFile) write(content string) {
+	f.t.Helper()
+	if err := os.WriteFile(f.path, []byte(content), 0644); err != nil {
+		f.t.Fatal(err)
+	}
+	f.touch(f.path)
+}
+
+func (f *testFile) append(content string) {
+	f.t.Helper()
+	file, err := os.OpenFile(f.path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		f.t.Fatal(err)
+	}
+	defer file.Close()
+	if _, err := file.WriteString(content); err != nil {
+		f.t.Fatal(err)
+	}
+	f.touch(f.path)
+}
+
+// replace 像很多日志软件保存时那样写入临时文件再重命名覆盖
+func (f *testFile) replace(content string) {
+	f.t.Helper()
+	tmp := f.path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(content), 0644); err != nil {
+		f.t.Fatal(err)
+	}
+	f.touch(tmp)
+	if err := os.Rename(tmp, f.path); err != nil {
+		f.t.Fatal(err)
+	}
+}
+
+func (f *testFile) watcher(fromStart bool) *ADIWatcher {
+	f.t.Helper()
+	w, err := newADIWatcher(f.path, f.state, func(e source.Event) {
+		f.events = append(f.events, e.Kind.String()+" "+strings.SplitN(e.Identity, "|", 2)[0])
+	}, fromStart)
+	if err != nil {
+		f.t.Fatalf("newADIWatcher() error = %v", err)
+	}
+	return w
+}
+
+// poll 检查一次文件，返回这次上报的事件
+func (f *testFile) poll(w *ADIWatcher) []string {
+	f.events = nil
+	w.poll()
+	return f.events
+}
+
+func expectEvents(t *testing.T, step string, got []string, want ...string) {
+	t.Helper()
+	slices.Sort(got)
+	slices.Sort(want)
+	if !slices.Equal(got, want) {
+		t.Errorf("%s: events = %q, want %q", step, got, want)
+	}
+}
+
+func TestWatcherExistingRecordsAreKnown(t *testing.T) {
+	f := newTestFile(t, "log.adi", header+record("K1ABC", ""))
+	w := f.watcher(false)
+	expectEvents(t, "start", f.poll(w))
+
+	f.append(record("K1ABC", "") + record("K2ABC", ""))
+	expectEvents(t, "append", f.poll(w), "added K2ABC")
+}
+
+func TestWatcherFromStart(t *testing.T) {
+	f := newTestFile(t, "log.adi", header+record("K1ABC", "")+record("K2ABC", ""))
+	w := f.watcher(true)
+	expectEvents(t, "first poll", f.poll(w), "added K1ABC", "added K2ABC")
+	expectEvents(t, "second poll", f.poll(w))
+}
+
+func TestWatcherAppendAfterPartialRecord(t *testing.T) {
+	f := newTestFile(t, "log.adi", header+record("K1ABC", ""))
+	w := f.watcher(false)
+
+	full := record("K2ABC", "hello")
+	f.append(full[:20])
+	expectEvents(t, "partial record", f.poll(w))
+
+	f.append(full[20:] + record("K3ABC", ""))
+	expectEvents(t, "rest of the record", f.poll(w), "added K2ABC", "added K3ABC")
+
+	// 同一个 QSO 再次追加且内容不同时是修改
+	f.append(record("K2ABC", "changed"))
+	expectEvents(t, "changed copy", f.poll(w), "updated K2ABC")
+}
+
+func TestWatcherRenameOver(t *testing.T) {
+	f := newTestFile(t, "log.adi", header+record("K1ABC", "")+record("K2ABC", "")+record("K3ABC", ""))
+	w := f.watcher(false)
+
+	f.replace(header + record("K1ABC", "") + record("K2ABC", "edited") + record("K4ABC", ""))
+	expectEvents(t, "replaced", f.poll(w))
+	expectEvents(t, "settled", f.poll(w), "updated K2ABC", "deleted K3ABC", "added K4ABC")
+	expectEvents(t, "unchanged", f.poll(w))
+
+	f.append(record("K5ABC", ""))
+	expectEvents(t, "append to the new file", f.poll(w), "added K5ABC")
+}
+
+func TestWatcherTruncateAndRewrite(t *testing.T) {
+	content := header + record("K1ABC", "") + record("K2ABC", "")
+	f := newTestFile(t, "log.adi", content)
+	w := f.watcher(false)
+
+	// 原地改写的程序先截断文件再分几次写入，写到一半时不能比较
+	rewritten := content + record("K3ABC", "")
+	f.write(rewritten[:len(header)+10])
+	expectEvents(t, "truncated", f.poll(w))
+	f.write(rewritten[:len(rewritten)-30])
+	expectEvents(t, "half written", f.poll(w))
+	f.write(rewritten)
+	expectEvents(t, "fully written", f.poll(w))
+	expectEvents(t, "settled", f.poll(w), "added K3ABC")
+}
+
+func TestWatcherInPlaceEdit(t *testing.T) {
+	f := newTestFile(t, "log.adi", header+record("K1ABC", "aaaa")+record("K2ABC", ""))
+	w := f.watcher(false)
+
+	// 大小不变，只有内容被修改
+	f.write(header + record("K1ABC", "bbbb") + record("K2ABC", ""))
+	expectEvents(t, "edited", f.poll(w))
+	expectEvents(t, "settled", f.poll(w), "updated K1ABC")
+}
+
+func TestWatcherResumeFromCheckpoint(t *testing.T) {
+	f := newTestFile(t, "log.adi", header+record("K1ABC", ""))
+	w := f.watcher(false)
+	f.append(record("K2ABC", ""))
+	expectEvents(t, "append", f.poll(w), "added K2ABC")
+
+	// 停止期间追加的记录在重启后上报，之前的不再上报
+	f.append(record("K3ABC", ""))
+	w = f.watcher(false)
+	expectEvents(t, "resumed", f.poll(w), "added K3ABC")
+
+	// 停止期间文件被改写时与检查点中的已知记录比较
+	f.replace(header + record("K1ABC", "") + record("K3ABC", "edited") + record("K4ABC", ""))
+	w = f.watcher(false)
+	expectEvents(t, "rewritten while stopped", f.poll(w), "deleted K2ABC", "updated K3ABC", "added K4ABC")
+	expectEvents(t, "after rewrite", f.poll(w))
+}
+
+func TestWatcherADX(t *testing.T) {
+	adx := func(calls ...string) string {
+		var b strings.Builder
+		b.WriteString(`<?xml version="1.0" encoding="UTF-8"?><ADX><HEADER><ADIF_VER>3.1.4</ADIF_VER></HEADER><RECORDS>`)
+		for _, call := range calls {
+			fmt.Fprintf(&b, "<RECORD><CALL>%s</CALL><QSO_DATE>20240601</QSO_DATE><TIME_ON>1200</TIME_ON><BAND>20m</BAND><MODE>CW</MODE></RECORD>", call)
+		}
+		b.WriteString("</RECORDS></ADX>")
+		return b.String()
+	}
+	f := newTestFile(t, "log.adx", adx("K1ABC"))
+	w := f.watcher(false)
+
+	f.write(adx("K1ABC", "K2ABC"))
+	expectEvents(t, "written", f.poll(w))
+	expectEvents(t, "settled", f.poll(w), "added K2ABC")
+}
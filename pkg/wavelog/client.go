@@ -2,13 +2,18 @@ package wavelog
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"log/slog"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"git.esd.cc/imlonghao/adif2cloud/internal/consts"
+	"git.esd.cc/imlonghao/adif2cloud/pkg/provider"
+
 	"github.com/projectdiscovery/retryablehttp-go"
 )
 
@@ -16,6 +21,7 @@ type Client struct {
 	apiURL           string
 	apiKey           string
 	stationProfileID int
+	client           *retryablehttp.Client
 }
 
 type QSORequest struct {
@@ -25,6 +31,31 @@ type QSORequest struct {
 	String           string `json:"string"`
 }
 
+// QSOResponse 是 Wavelog 导入 ADIF 后返回的结果
+type QSOResponse struct {
+	Status     string   `json:"status"`
+	ADIFCount  int      `json:"adif_count"`
+	ADIFErrors int      `json:"adif_errors"`
+	Messages   []string `json:"messages"`
+}
+
+// rejection 返回导入失败的错误。重复的 QSO 已经在 Wavelog 中，只有重复时视为成功
+func (r *QSOResponse) rejection(records int) error {
+	if r.ADIFErrors == 0 {
+		return nil
+	}
+	var messages []string
+	for _, message := range r.Messages {
+		if !strings.Contains(strings.ToLower(message), "duplicate") {
+			messages = append(messages, message)
+		}
+	}
+	if len(r.Messages) > 0 && len(messages) == 0 {
+		return nil
+	}
+	return provider.Permanent(fmt.Errorf("%d of %d records rejected: %s", r.ADIFErrors, records, strings.Join(messages, "; ")))
+}
+
 func NewClient(apiURL, apiKey string, stationProfileID int) *Client {
 	slog.Debug("Creating Wavelog client",
 		"api_url", apiURL,
@@ -33,10 +64,29 @@ func NewClient(apiURL, apiKey string, stationProfileID int) *Client {
 		apiURL:           apiURL,
 		apiKey:           apiKey,
 		stationProfileID: stationProfileID,
+		client:           retryablehttp.NewClient(retryablehttp.DefaultOptionsSingle),
 	}
 }
 
-func (c *Client) SendQSO(adiString string) error {
+// SendQSO 发送一条 ADI 记录，Wavelog 拒绝导入时返回永久错误
+func (c *Client) SendQSO(ctx context.Context, adiString string) error {
+	result, err := c.send(ctx, adiString)
+	if err != nil {
+		return err
+	}
+	return result.rejection(1)
+}
+
+// SendQSOs 在一次请求中发送多条 ADI 记录，Wavelog 报告有记录导入失败时返回永久错误
+func (c *Client) SendQSOs(ctx context.Context, records []string) error {
+	result, err := c.send(ctx, strings.Join(records, "\n"))
+	if err != nil {
+		return err
+	}
+	return result.rejection(len(records))
+}
+
+func (c *Client) send(ctx context.Context, adiString string) (*QSOResponse, error) {
 	qsoReq := QSORequest{
 		Key:              c.apiKey,
 		StationProfileID: strconv.Itoa(c.stationProfileID),
@@ -46,25 +96,30 @@ func (c *Client) SendQSO(adiString string) error {
 
 	jsonData, err := json.Marshal(qsoReq)
 	if err != nil {
-		return fmt.Errorf("failed to marshal request: %w", err)
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
 	}
 
-	client := retryablehttp.NewClient(retryablehttp.DefaultOptionsSingle)
-	req, err := retryablehttp.NewRequest(http.MethodPost, c.apiURL, bytes.NewBuffer(jsonData))
+	req, err := retryablehttp.NewRequestWithContext(ctx, http.MethodPost, c.apiURL, bytes.NewBuffer(jsonData))
 	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
+		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("User-Agent", fmt.Sprintf("adif2cloud/%s (+https://git.esd.cc/imlonghao/adif2cloud)", consts.Version))
-	resp, err := client.Do(req)
+	resp, err := c.client.Do(req)
 	if err != nil {
-		return fmt.Errorf("failed to send request: %w", err)
+		return nil, fmt.Errorf("failed to send request: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusCreated {
-		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+		body, _ := io.ReadAll(resp.Body)
+		return nil, provider.StatusError(resp.StatusCode, string(body))
 	}
 
-	return nil
+	// 旧版本的 Wavelog 不一定返回这些字段，解析失败时视为全部成功
+	var result QSOResponse
+	if body, err := io.ReadAll(resp.Body); err == nil {
+		json.Unmarshal(body, &result)
+	}
+	return &result, nil
 }
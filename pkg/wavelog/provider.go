@@ -1,10 +1,33 @@
 package wavelog
 
 import (
+	"context"
 	"fmt"
 	"io"
+	"log/slog"
+
+	"git.esd.cc/imlonghao/adif2cloud/pkg/provider"
+)
+
+const (
+	// batchRecords 和 batchBytes 是单次批量导入的上限，避免请求超过 PHP 的 post_max_size
+	batchRecords = 200
+	batchBytes   = 1 << 20
 )
 
+// WavelogConfig 定义了 Wavelog 配置
+type WavelogConfig struct {
+	APIURL           string `mapstructure:"api_url" required:"true"`
+	APIKey           string `mapstructure:"api_key" required:"true"`
+	StationProfileID int    `mapstructure:"station_profile_id" required:"true"`
+}
+
+func init() {
+	provider.Register("wavelog", func(cfg WavelogConfig) (provider.Provider, error) {
+		return NewWavelogProvider(cfg.APIURL, cfg.APIKey, cfg.StationProfileID), nil
+	})
+}
+
 // WavelogProvider 实现了 Provider 接口，用于 Wavelog 服务
 type WavelogProvider struct {
 	client *Client
@@ -18,21 +41,51 @@ func NewWavelogProvider(apiURL, apiKey string, stationProfileID int) *WavelogPro
 }
 
 // GetSize 获取 Wavelog 上 ADIF 文件的大小
-func (p *WavelogProvider) GetSize() (int64, error) {
+func (p *WavelogProvider) GetSize(_ context.Context) (int64, error) {
 	// Wavelog 不直接提供文件大小，返回 0
 	return 0, nil
 }
 
 // Download 从 Wavelog 下载 ADIF 文件
-func (p *WavelogProvider) Download(w io.Writer) error {
+func (p *WavelogProvider) Download(_ context.Context, w io.Writer) error {
 	// Wavelog 不直接提供下载功能，返回错误
 	return fmt.Errorf("wavelog does not support direct file download")
 }
 
 // Upload 上传 QSO 记录到 Wavelog
-func (p *WavelogProvider) Upload(_ string, line string) error {
+func (p *WavelogProvider) Upload(ctx context.Context, _ string, line string) error {
 	// 将内容作为 QSO 记录发送
-	return p.client.SendQSO(line)
+	return p.client.SendQSO(ctx, line)
+}
+
+// UploadBatch 批量上传 QSO 记录到 Wavelog，每个请求最多 batchRecords 条。
+// Wavelog 只返回整批的错误数，一批中有记录被拒绝时逐条重新上传这一批，
+// 得到每条记录各自的结果，已经导入的记录会作为重复的 QSO 被跳过
+func (p *WavelogProvider) UploadBatch(ctx context.Context, _ string, lines []string) []error {
+	errs := make([]error, 0, len(lines))
+	for _, batch := range provider.Batches(lines, batchRecords, batchBytes) {
+		err := p.sendQSOs(ctx, batch)
+		if len(batch) == 1 || !provider.IsPermanent(err) {
+			errs = append(errs, provider.Fill(len(batch), err)...)
+			continue
+		}
+		slog.Warn("Wavelog rejected records in a batch, uploading them one at a time", "records", len(batch), "error", err)
+		for _, line := range batch {
+			if ctx.Err() != nil {
+				errs = append(errs, ctx.Err())
+				continue
+			}
+			errs = append(errs, p.sendQSOs(ctx, []string{line}))
+		}
+	}
+	return errs
+}
+
+// sendQSOs 在一个请求中发送记录，超时单独计算
+func (p *WavelogProvider) sendQSOs(ctx context.Context, lines []string) error {
+	ctx, cancel := provider.RequestContext(ctx)
+	defer cancel()
+	return p.client.SendQSOs(ctx, lines)
 }
 
 // GetName 获取提供商的名称
@@ -0,0 +1,110 @@
+package wavelog
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"git.esd.cc/imlonghao/adif2cloud/pkg/provider"
+)
+
+// fakeWavelog 像 Wavelog 一样逐条导入请求中的记录，呼号为 BAD 的记录被拒绝，已经导入的记录报告为重复
+type fakeWavelog struct {
+	mu       sync.Mutex
+	imported map[string]bool
+	requests int
+}
+
+func (f *fakeWavelog) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req QSORequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.requests++
+	var result QSOResponse
+	for _, record := range strings.Split(req.String, "\n") {
+		switch {
+		case strings.Contains(record, "BAD"):
+			result.ADIFErrors++
+			result.Messages = append(result.Messages, "Invalid callsign BAD")
+		case f.imported[record]:
+			result.ADIFErrors++
+			result.Messages = append(result.Messages, "Duplicate for "+record)
+		default:
+			f.imported[record] = true
+			result.ADIFCount++
+		}
+	}
+	result.Status = "created"
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(result)
+}
+
+func TestUploadBatch(t *testing.T) {
+	tests := []struct {
+		name     string
+		existing []string
+		lines    []string
+		wantErr  []bool
+		wantReqs int
+	}{
+		{
+			name:     "all accepted in one request",
+			lines:    []string{"K1ABC", "K2ABC", "K3ABC"},
+			wantErr:  []bool{false, false, false},
+			wantReqs: 1,
+		},
+		{
+			name:     "duplicates are not errors",
+			existing: []string{"K2ABC"},
+			lines:    []string{"K1ABC", "K2ABC"},
+			wantErr:  []bool{false, false},
+			wantReqs: 1,
+		},
+		{
+			name:     "one rejected record does not fail the others",
+			lines:    []string{"K1ABC", "BAD", "K3ABC"},
+			wantErr:  []bool{false, true, false},
+			wantReqs: 4,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := &fakeWavelog{imported: make(map[string]bool)}
+			for _, record := range tt.existing {
+				fake.imported[record] = true
+			}
+			server := httptest.NewServer(fake)
+			defer server.Close()
+
+			p := NewWavelogProvider(server.URL, "key", 1)
+			errs := p.UploadBatch(context.Background(), "", tt.lines)
+			if len(errs) != len(tt.lines) {
+				t.Fatalf("UploadBatch() returned %d results, want %d", len(errs), len(tt.lines))
+			}
+			for i, err := range errs {
+				if (err != nil) != tt.wantErr[i] {
+					t.Errorf("record %q: error = %v, want error %v", tt.lines[i], err, tt.wantErr[i])
+				}
+				if err != nil && !provider.IsPermanent(err) {
+					t.Errorf("record %q: error %v is not permanent", tt.lines[i], err)
+				}
+			}
+			if fake.requests != tt.wantReqs {
+				t.Errorf("requests = %d, want %d", fake.requests, tt.wantReqs)
+			}
+			for i, line := range tt.lines {
+				if !tt.wantErr[i] && !fake.imported[line] {
+					t.Errorf("record %q was not imported", line)
+				}
+			}
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package webhook
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"log/slog"
@@ -9,20 +10,28 @@ import (
 
 	"git.esd.cc/imlonghao/adif2cloud/internal/consts"
 	"git.esd.cc/imlonghao/adif2cloud/pkg/adif"
+	"git.esd.cc/imlonghao/adif2cloud/pkg/provider"
 	"github.com/projectdiscovery/retryablehttp-go"
 )
 
 // WebhookConfig 定义了 Webhook 配置
 type WebhookConfig struct {
-	URL     string            `mapstructure:"url"`
+	URL     string            `mapstructure:"url" required:"true"`
 	Method  string            `mapstructure:"method"`
 	Headers map[string]string `mapstructure:"headers"`
 	Body    string            `mapstructure:"body"`
 }
 
+func init() {
+	provider.Register("webhook", func(cfg WebhookConfig) (provider.Provider, error) {
+		return NewWebhookProvider(cfg), nil
+	})
+}
+
 // WebhookProvider 实现了 Provider 接口，用于 Webhook 服务
 type WebhookProvider struct {
 	config WebhookConfig
+	client *retryablehttp.Client
 }
 
 // NewWebhookProvider 创建一个新的 WebhookProvider 实例
@@ -32,25 +41,24 @@ func NewWebhookProvider(cfg WebhookConfig) *WebhookProvider {
 		"method", cfg.Method)
 	return &WebhookProvider{
 		config: cfg,
+		client: retryablehttp.NewClient(retryablehttp.DefaultOptionsSingle),
 	}
 }
 
 // GetSize 获取 Webhook 上 ADIF 文件的大小
-func (p *WebhookProvider) GetSize() (int64, error) {
+func (p *WebhookProvider) GetSize(_ context.Context) (int64, error) {
 	// Webhook 不直接提供文件大小，返回 0
 	return 0, nil
 }
 
 // Download 从 Webhook 下载 ADIF 文件
-func (p *WebhookProvider) Download(w io.Writer) error {
+func (p *WebhookProvider) Download(_ context.Context, w io.Writer) error {
 	// Webhook 不直接提供下载功能，返回错误
 	return fmt.Errorf("webhook does not support direct file download")
 }
 
 // Upload 上传 QSO 记录到 Webhook
-func (p *WebhookProvider) Upload(_, line string) error {
-	client := retryablehttp.NewClient(retryablehttp.DefaultOptionsSingle)
-
+func (p *WebhookProvider) Upload(ctx context.Context, _, line string) error {
 	// 准备请求体
 	var bodyReader io.Reader
 	if p.config.Body != "" {
@@ -66,7 +74,7 @@ func (p *WebhookProvider) Upload(_, line string) error {
 	if method == "" {
 		method = http.MethodGet
 	}
-	req, err := retryablehttp.NewRequest(method, p.config.URL, bodyReader)
+	req, err := retryablehttp.NewRequestWithContext(ctx, method, p.config.URL, bodyReader)
 	if err != nil {
 		return fmt.Errorf("failed to create request: %w", err)
 	}
@@ -78,7 +86,7 @@ func (p *WebhookProvider) Upload(_, line string) error {
 	}
 
 	// 发送请求
-	resp, err := client.Do(req)
+	resp, err := p.client.Do(req)
 	if err != nil {
 		return fmt.Errorf("failed to send request: %w", err)
 	}
@@ -87,7 +95,7 @@ func (p *WebhookProvider) Upload(_, line string) error {
 	// 检查响应状态码
 	if resp.StatusCode >= http.StatusMultipleChoices {
 		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("unexpected status code: %d, body: %s", resp.StatusCode, string(body))
+		return provider.StatusError(resp.StatusCode, string(body))
 	}
 
 	return nil
@@ -0,0 +1,195 @@
+package wsjtx
+
+import (
+	"errors"
+	"log/slog"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"git.esd.cc/imlonghao/adif2cloud/pkg/adif"
+	"git.esd.cc/imlonghao/adif2cloud/pkg/source"
+)
+
+// adifWait 是收到 QSOLogged 后等待同一个 QSO 的 LoggedADIF 的时间。
+// 两者通常一起发送，LoggedADIF 包含更完整的字段，优先使用
+const adifWait = 2 * time.Second
+
+// Config 定义了 WSJT-X UDP 来源的配置
+type Config struct {
+	// Listen 是监听的地址，例如 127.0.0.1:2237；地址为组播地址时加入该组播组，例如 224.0.0.73:2237
+	Listen string `mapstructure:"listen"`
+	// Interface 是加入组播组使用的网卡名称，为空时由系统选择
+	Interface string `mapstructure:"interface"`
+}
+
+// Listener 接收 WSJT-X、JTDX 等程序通过 UDP 发送的消息，把记录的 QSO 作为新增事件上报。
+// 多个实例可以发送到同一个地址，按 client id 区分
+type Listener struct {
+	addr     *net.UDPAddr
+	conn     *net.UDPConn
+	callback func(source.Event)
+
+	mu      sync.Mutex
+	clients map[string]*client
+
+	started bool
+	done    chan struct{}
+}
+
+// client 是一个 WSJT-X 实例的状态
+type client struct {
+	// sendsADIF 表示该实例发送过 LoggedADIF，之后只使用 LoggedADIF
+	sendsADIF bool
+	// pending 是等待 LoggedADIF 的 QSOLogged，键为 qsoKey
+	pending map[string]*pendingQSO
+}
+
+// pendingQSO 是一条由 QSOLogged 转换、等待上报的记录
+type pendingQSO struct {
+	timer *time.Timer
+	event source.Event
+}
+
+// NewListener 创建 WSJT-X 来源并开始监听
+func NewListener(cfg Config, callback func(source.Event)) (*Listener, error) {
+	slog.Info("Creating WSJT-X listener", "listen", cfg.Listen)
+	conn, addr, err := source.ListenUDP(cfg.Listen, cfg.Interface)
+	if err != nil {
+		return nil, err
+	}
+	return &Listener{
+		addr:     addr,
+		conn:     conn,
+		callback: callback,
+		clients:  make(map[string]*client),
+		done:     make(chan struct{}),
+	}, nil
+}
+
+func (l *Listener) Start() error {
+	slog.Info("Starting WSJT-X listener", "listen", l.addr.String(), "multicast", l.addr.IP.IsMulticast())
+	l.started = true
+	go l.listen()
+	return nil
+}
+
+func (l *Listener) listen() {
+	defer close(l.done)
+	buf := make([]byte, 64*1024)
+	for {
+		n, from, err := l.conn.ReadFromUDP(buf)
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				slog.Error("Failed to read WSJT-X message", "error", err)
+			}
+			return
+		}
+		msg, err := Decode(buf[:n])
+		if err != nil {
+			// 组播组中也可能有其他程序的消息
+			slog.Debug("Ignoring invalid WSJT-X message", "from", from, "error", err)
+			continue
+		}
+		for _, event := range l.handle(msg) {
+			l.callback(event)
+		}
+	}
+}
+
+// handle 处理一个消息，返回需要立即上报的事件
+func (l *Listener) handle(msg *Message) []source.Event {
+	logger := slog.With("client_id", msg.ID)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	c, known := l.clients[msg.ID]
+	if !known {
+		c = &client{pending: make(map[string]*pendingQSO)}
+		l.clients[msg.ID] = c
+	}
+
+	switch body := msg.Body.(type) {
+	case *Heartbeat:
+		if !known {
+			logger.Info("WSJT-X instance connected", "version", body.Version, "revision", body.Revision, "schema", msg.Schema)
+		}
+	case *Close:
+		logger.Info("WSJT-X instance closed")
+		delete(l.clients, msg.ID)
+	case *QSOLogged:
+		if c.sendsADIF {
+			logger.Debug("Ignoring QSO Logged message, using the Logged ADIF message instead", "call", body.DXCall)
+			return nil
+		}
+		fields := body.Fields()
+		record, err := adif.FormatRecord(fields)
+		if err != nil {
+			logger.Warn("Failed to convert logged QSO", "call", body.DXCall, "error", err)
+			return nil
+		}
+		key := qsoKey(fields)
+		p := &pendingQSO{event: source.Event{Kind: source.Added, Identity: adif.Identity(fields), Record: record}}
+		p.timer = time.AfterFunc(adifWait, func() {
+			l.mu.Lock()
+			if c.pending[key] != p {
+				l.mu.Unlock()
+				return
+			}
+			delete(c.pending, key)
+			l.mu.Unlock()
+			logger.Info("Received QSO from WSJT-X", "call", body.DXCall)
+			l.callback(p.event)
+		})
+		c.pending[key] = p
+	case *LoggedADIF:
+		c.sendsADIF = true
+		var events []source.Event
+		for _, record := range adif.Split(body.ADIF) {
+			fields := adif.Parse(record)
+			key := qsoKey(fields)
+			if p := c.pending[key]; p != nil {
+				p.timer.Stop()
+				delete(c.pending, key)
+			}
+			logger.Info("Received QSO from WSJT-X", "call", fields["call"])
+			events = append(events, source.Event{Kind: source.Added, Identity: adif.Identity(fields), Record: record})
+		}
+		return events
+	}
+	return nil
+}
+
+// qsoKey 用于匹配同一个 QSO 的 QSOLogged 和 LoggedADIF。
+// 两者的模式写法可能不同（例如 FT4 与 MFSK/FT4），所以只用呼号和开始时间
+func qsoKey(fields map[string]string) string {
+	timeOn := fields["time_on"]
+	if len(timeOn) > 4 {
+		timeOn = timeOn[:4]
+	}
+	return strings.ToUpper(strings.TrimSpace(fields["call"])) + "|" + fields["qso_date"] + "|" + timeOn
+}
+
+// Close 停止监听，仍在等待 LoggedADIF 的 QSO 会立即上报
+func (l *Listener) Close() {
+	slog.Info("Closing WSJT-X listener", "listen", l.addr.String())
+	l.conn.Close()
+	if l.started {
+		<-l.done
+	}
+	var events []source.Event
+	l.mu.Lock()
+	for _, c := range l.clients {
+		for key, p := range c.pending {
+			if p.timer.Stop() {
+				events = append(events, p.event)
+			}
+			delete(c.pending, key)
+		}
+	}
+	l.mu.Unlock()
+	for _, event := range events {
+		l.callback(event)
+	}
+}
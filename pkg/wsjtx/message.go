@@ -0,0 +1,242 @@
+package wsjtx
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"git.esd.cc/imlonghao/adif2cloud/pkg/adif"
+)
+
+// Magic 是每个 WSJT-X UDP 数据报开头的魔数
+const Magic = 0xadbccbda
+
+// 本包解码的消息类型，其余类型只解码消息头
+const (
+	TypeHeartbeat  = 0
+	TypeQSOLogged  = 5
+	TypeClose      = 6
+	TypeLoggedADIF = 12
+)
+
+// Message 是一个解码后的 WSJT-X UDP 消息
+type Message struct {
+	Schema uint32
+	Type   uint32
+	// ID 是发送消息的 WSJT-X 实例的 client id，多个实例同时运行时各不相同
+	ID string
+	// Body 是 *Heartbeat、*QSOLogged、*Close 或 *LoggedADIF，其他类型为 nil
+	Body any
+}
+
+// Heartbeat 是实例定期发送的心跳
+type Heartbeat struct {
+	MaxSchema uint32
+	Version   string
+	Revision  string
+}
+
+// Close 表示实例已经退出
+type Close struct{}
+
+// QSOLogged 是用户在 WSJT-X 中记录 QSO 时发送的消息
+type QSOLogged struct {
+	TimeOff          time.Time
+	DXCall           string
+	DXGrid           string
+	TxFrequency      uint64 // Hz
+	Mode             string
+	ReportSent       string
+	ReportReceived   string
+	TxPower          string
+	Comments         string
+	Name             string
+	TimeOn           time.Time
+	OperatorCall     string
+	MyCall           string
+	MyGrid           string
+	ExchangeSent     string
+	ExchangeReceived string
+	PropMode         string
+}
+
+// LoggedADIF 是与 QSOLogged 同时发送的 ADIF 文本，包含文件头和一条记录
+type LoggedADIF struct {
+	ADIF string
+}
+
+// Decode 解码一个 UDP 数据报。数据报使用 Qt QDataStream 的大端序编码，
+// 新版本在消息末尾追加的字段会被忽略，旧版本缺少的末尾字段为空值
+func Decode(data []byte) (*Message, error) {
+	r := &reader{data: data}
+	if magic := r.uint32(); r.err != nil || magic != Magic {
+		return nil, errors.New("not a WSJT-X message")
+	}
+	msg := &Message{Schema: r.uint32(), Type: r.uint32(), ID: r.utf8()}
+	if r.err != nil {
+		return nil, fmt.Errorf("invalid WSJT-X message header: %w", r.err)
+	}
+
+	switch msg.Type {
+	case TypeHeartbeat:
+		msg.Body = &Heartbeat{MaxSchema: r.uint32(), Version: r.utf8(), Revision: r.optional().utf8()}
+	case TypeQSOLogged:
+		q := &QSOLogged{
+			TimeOff:        r.dateTime(),
+			DXCall:         r.utf8(),
+			DXGrid:         r.utf8(),
+			TxFrequency:    r.uint64(),
+			Mode:           r.utf8(),
+			ReportSent:     r.utf8(),
+			ReportReceived: r.utf8(),
+			TxPower:        r.utf8(),
+			Comments:       r.utf8(),
+			Name:           r.utf8(),
+			TimeOn:         r.dateTime(),
+		}
+		// 以下字段由较新的版本加入
+		r = r.optional()
+		q.OperatorCall = r.utf8()
+		q.MyCall = r.utf8()
+		q.MyGrid = r.utf8()
+		q.ExchangeSent = r.utf8()
+		q.ExchangeReceived = r.utf8()
+		q.PropMode = r.utf8()
+		msg.Body = q
+	case TypeClose:
+		msg.Body = &Close{}
+	case TypeLoggedADIF:
+		msg.Body = &LoggedADIF{ADIF: r.utf8()}
+	}
+	if r.err != nil {
+		return nil, fmt.Errorf("invalid WSJT-X message type %d: %w", msg.Type, r.err)
+	}
+	return msg, nil
+}
+
+// Fields 把 QSOLogged 转换为 ADIF 字段
+func (q *QSOLogged) Fields() map[string]string {
+	fields := map[string]string{
+		"call":             q.DXCall,
+		"gridsquare":       q.DXGrid,
+		"mode":             q.Mode,
+		"rst_sent":         q.ReportSent,
+		"rst_rcvd":         q.ReportReceived,
+		"tx_pwr":           q.TxPower,
+		"comment":          q.Comments,
+		"name":             q.Name,
+		"operator":         q.OperatorCall,
+		"station_callsign": q.MyCall,
+		"my_gridsquare":    q.MyGrid,
+		"stx_string":       q.ExchangeSent,
+		"srx_string":       q.ExchangeReceived,
+		"prop_mode":        q.PropMode,
+	}
+	if q.TxFrequency > 0 {
+		mhz := float64(q.TxFrequency) / 1e6
+		fields["freq"] = strconv.FormatFloat(mhz, 'f', -1, 64)
+		fields["band"] = adif.FreqToBand(mhz)
+	}
+	if !q.TimeOn.IsZero() {
+		fields["qso_date"] = q.TimeOn.UTC().Format("20060102")
+		fields["time_on"] = q.TimeOn.UTC().Format("150405")
+	}
+	if !q.TimeOff.IsZero() {
+		fields["qso_date_off"] = q.TimeOff.UTC().Format("20060102")
+		fields["time_off"] = q.TimeOff.UTC().Format("150405")
+	}
+	return fields
+}
+
+var errShort = errors.New("message is truncated")
+
+// reader 按 QDataStream 的格式读取数据，出错后后续读取都返回零值
+type reader struct {
+	data []byte
+	err  error
+	// lenient 为 true 时数据结束不算错误，用于读取可选的末尾字段
+	lenient bool
+}
+
+// optional 把 reader 切换为数据结束时不报错的模式，用于读取可选的末尾字段
+func (r *reader) optional() *reader {
+	r.lenient = true
+	return r
+}
+
+func (r *reader) next(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if len(r.data) < n {
+		if !r.lenient || len(r.data) != 0 {
+			r.err = errShort
+		}
+		return nil
+	}
+	b := r.data[:n]
+	r.data = r.data[n:]
+	return b
+}
+
+func (r *reader) uint8() uint8 {
+	if b := r.next(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+func (r *reader) uint32() uint32 {
+	if b := r.next(4); b != nil {
+		return binary.BigEndian.Uint32(b)
+	}
+	return 0
+}
+
+func (r *reader) uint64() uint64 {
+	if b := r.next(8); b != nil {
+		return binary.BigEndian.Uint64(b)
+	}
+	return 0
+}
+
+// utf8 读取 QByteArray 编码的 UTF-8 字符串，长度为 0xffffffff 表示空值
+func (r *reader) utf8() string {
+	n := r.uint32()
+	if n == math.MaxUint32 || r.err != nil {
+		return ""
+	}
+	if int(n) > len(r.data) {
+		r.err = errShort
+		return ""
+	}
+	return string(r.next(int(n)))
+}
+
+// dateTime 读取 QDateTime：儒略日、午夜起的毫秒数和时间类型，无效日期返回零值
+func (r *reader) dateTime() time.Time {
+	julianDay := int64(r.uint64())
+	ms := r.uint32()
+	spec := r.uint8()
+	offset := 0
+	switch spec {
+	case 0, 1:
+		// 本地时间和 UTC，WSJT-X 总是发送 UTC
+	case 2:
+		offset = int(int32(r.uint32()))
+	default:
+		if r.err == nil {
+			r.err = fmt.Errorf("unsupported time spec %d", spec)
+		}
+		return time.Time{}
+	}
+	if r.err != nil || julianDay <= 0 || ms == math.MaxUint32 {
+		return time.Time{}
+	}
+	// 儒略日 2440588 是 1970-01-01
+	t := time.Unix((julianDay-2440588)*86400, 0).UTC().Add(time.Duration(ms) * time.Millisecond)
+	return t.Add(-time.Duration(offset) * time.Second)
+}
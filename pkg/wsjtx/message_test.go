@@ -0,0 +1,268 @@
+package wsjtx
+
+import (
+	"encoding/binary"
+	"maps"
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+// datagram 按 QDataStream 的格式构造 WSJT-X 数据报
+type datagram []byte
+
+func newDatagram(msgType uint32, id string) datagram {
+	return datagram(nil).u32(Magic).u32(3).u32(msgType).str(id)
+}
+
+func (d datagram) u8(v uint8) datagram { return append(d, v) }
+
+func (d datagram) u32(v uint32) datagram { return binary.BigEndian.AppendUint32(d, v) }
+
+func (d datagram) u64(v uint64) datagram { return binary.BigEndian.AppendUint64(d, v) }
+
+func (d datagram) str(s string) datagram { return append(d.u32(uint32(len(s))), s...) }
+
+func (d datagram) null() datagram { return d.u32(math.MaxUint32) }
+
+// utc 写入时间类型为 UTC 的 QDateTime
+func (d datagram) utc(t time.Time) datagram {
+	days := t.Unix() / 86400
+	ms := (t.Unix() % 86400 * 1000) + int64(t.Nanosecond()/1e6)
+	return d.u64(uint64(days + 2440588)).u32(uint32(ms)).u8(1)
+}
+
+var (
+	timeOn  = time.Date(2024, 6, 1, 12, 30, 15, 0, time.UTC)
+	timeOff = time.Date(2024, 6, 1, 12, 31, 45, 0, time.UTC)
+)
+
+// qsoLogged 构造一条较旧版本的 QSO Logged 消息，不含可选的末尾字段
+func qsoLogged() datagram {
+	return newDatagram(TypeQSOLogged, "WSJT-X").
+		utc(timeOff).
+		str("K1ABC").
+		str("FN42").
+		u64(14074000).
+		str("FT8").
+		str("-10").
+		str("-12").
+		str("100").
+		str("tnx").
+		null().
+		utc(timeOn)
+}
+
+func TestDecodeHeartbeat(t *testing.T) {
+	tests := []struct {
+		name string
+		data datagram
+		want Heartbeat
+	}{
+		{
+			name: "with revision",
+			data: newDatagram(TypeHeartbeat, "WSJT-X").u32(3).str("2.6.1").str("d7b6e2"),
+			want: Heartbeat{MaxSchema: 3, Version: "2.6.1", Revision: "d7b6e2"},
+		},
+		{
+			name: "without revision",
+			data: newDatagram(TypeHeartbeat, "WSJT-X").u32(2).str("1.9.0"),
+			want: Heartbeat{MaxSchema: 2, Version: "1.9.0"},
+		},
+		{
+			name: "trailing fields from a newer version",
+			data: newDatagram(TypeHeartbeat, "WSJT-X").u32(3).str("3.0.0").str("abc").u32(42),
+			want: Heartbeat{MaxSchema: 3, Version: "3.0.0", Revision: "abc"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg, err := Decode(tt.data)
+			if err != nil {
+				t.Fatalf("Decode() error = %v", err)
+			}
+			if msg.Schema != 3 || msg.Type != TypeHeartbeat || msg.ID != "WSJT-X" {
+				t.Errorf("header = %d, %d, %q", msg.Schema, msg.Type, msg.ID)
+			}
+			got, ok := msg.Body.(*Heartbeat)
+			if !ok {
+				t.Fatalf("Body = %T, want *Heartbeat", msg.Body)
+			}
+			if *got != tt.want {
+				t.Errorf("Body = %+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeQSOLogged(t *testing.T) {
+	tests := []struct {
+		name string
+		data datagram
+		want QSOLogged
+	}{
+		{
+			name: "without optional fields",
+			data: qsoLogged(),
+			want: QSOLogged{
+				TimeOff: timeOff, DXCall: "K1ABC", DXGrid: "FN42", TxFrequency: 14074000,
+				Mode: "FT8", ReportSent: "-10", ReportReceived: "-12", TxPower: "100",
+				Comments: "tnx", TimeOn: timeOn,
+			},
+		},
+		{
+			name: "with optional fields",
+			data: qsoLogged().str("BG2ABC").str("BG2ABC/P").str("PN11").str("5").str("7").str("SAT"),
+			want: QSOLogged{
+				TimeOff: timeOff, DXCall: "K1ABC", DXGrid: "FN42", TxFrequency: 14074000,
+				Mode: "FT8", ReportSent: "-10", ReportReceived: "-12", TxPower: "100",
+				Comments: "tnx", TimeOn: timeOn, OperatorCall: "BG2ABC", MyCall: "BG2ABC/P",
+				MyGrid: "PN11", ExchangeSent: "5", ExchangeReceived: "7", PropMode: "SAT",
+			},
+		},
+		{
+			name: "some optional fields",
+			data: qsoLogged().str("BG2ABC").str("BG2ABC"),
+			want: QSOLogged{
+				TimeOff: timeOff, DXCall: "K1ABC", DXGrid: "FN42", TxFrequency: 14074000,
+				Mode: "FT8", ReportSent: "-10", ReportReceived: "-12", TxPower: "100",
+				Comments: "tnx", TimeOn: timeOn, OperatorCall: "BG2ABC", MyCall: "BG2ABC",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg, err := Decode(tt.data)
+			if err != nil {
+				t.Fatalf("Decode() error = %v", err)
+			}
+			got, ok := msg.Body.(*QSOLogged)
+			if !ok {
+				t.Fatalf("Body = %T, want *QSOLogged", msg.Body)
+			}
+			if *got != tt.want {
+				t.Errorf("Body = %+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeOtherTypes(t *testing.T) {
+	msg, err := Decode(newDatagram(TypeClose, "JTDX"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := msg.Body.(*Close); !ok || msg.ID != "JTDX" {
+		t.Errorf("Decode(Close) = %+v", msg)
+	}
+
+	adif := "<ADIF_VER:5>3.1.0\n<EOH>\n<CALL:5>K1ABC <EOR>"
+	msg, err = Decode(newDatagram(TypeLoggedADIF, "WSJT-X").str(adif))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body, ok := msg.Body.(*LoggedADIF); !ok || body.ADIF != adif {
+		t.Errorf("Decode(LoggedADIF) = %+v", msg.Body)
+	}
+
+	// 其他类型（这里是 Decode 消息）只解码消息头
+	msg, err = Decode(newDatagram(2, "WSJT-X").u8(1).u32(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Type != 2 || msg.Body != nil {
+		t.Errorf("Decode(type 2) = %+v", msg)
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	full := qsoLogged()
+	tests := []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{"empty", nil, "not a WSJT-X message"},
+		{"bad magic", datagram(nil).u32(0xdeadbeef).u32(3).u32(0).str("x"), "not a WSJT-X message"},
+		{"short magic", []byte{0xad, 0xbc}, "not a WSJT-X message"},
+		{"truncated header", newDatagram(TypeHeartbeat, "WSJT-X")[:14], "invalid WSJT-X message header"},
+		{"id longer than data", datagram(nil).u32(Magic).u32(3).u32(0).u32(100).u8('x'), "invalid WSJT-X message header"},
+		{"truncated heartbeat", newDatagram(TypeHeartbeat, "WSJT-X").u32(3), "invalid WSJT-X message type 0"},
+		{"truncated QSO", full[:len(full)-5], "invalid WSJT-X message type 5"},
+		// 可选字段只能整体缺少，读到一半的字段仍然是错误
+		{"truncated optional field", full.str("BG2ABC").u32(10).u8('B'), "invalid WSJT-X message type 5"},
+		{"truncated ADIF", newDatagram(TypeLoggedADIF, "WSJT-X").u32(50).str("<CALL:5>"), "invalid WSJT-X message type 12"},
+		{"unsupported time spec", newDatagram(TypeQSOLogged, "WSJT-X").u64(2460463).u32(0).u8(3), "unsupported time spec 3"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg, err := Decode(tt.data)
+			if err == nil {
+				t.Fatalf("Decode() = %+v, expected an error", msg)
+			}
+			if !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Decode() error = %q, want it to contain %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestDateTime(t *testing.T) {
+	tests := []struct {
+		name string
+		data datagram
+		want time.Time
+	}{
+		// 儒略日 2460463 是 2024-06-01
+		{"utc", datagram(nil).u64(2460463).u32(45015500).u8(1), time.Date(2024, 6, 1, 12, 30, 15, 500e6, time.UTC)},
+		{"local time", datagram(nil).u64(2440588).u32(0).u8(0), time.Unix(0, 0).UTC()},
+		{"offset from UTC", datagram(nil).u64(2460463).u32(45015000).u8(2).u32(8 * 3600), time.Date(2024, 6, 1, 4, 30, 15, 0, time.UTC)},
+		{"negative offset", datagram(nil).u64(2460463).u32(0).u8(2).u32(uint32(-5 * 3600 & 0xffffffff)), time.Date(2024, 6, 1, 5, 0, 0, 0, time.UTC)},
+		{"null date", datagram(nil).u64(0).u32(math.MaxUint32).u8(1), time.Time{}},
+		{"null time", datagram(nil).u64(2460463).u32(math.MaxUint32).u8(1), time.Time{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &reader{data: tt.data}
+			got := r.dateTime()
+			if r.err != nil {
+				t.Fatalf("dateTime() error = %v", r.err)
+			}
+			if !got.Equal(tt.want) {
+				t.Errorf("dateTime() = %v, want %v", got, tt.want)
+			}
+			if len(r.data) != 0 {
+				t.Errorf("%d bytes left after dateTime()", len(r.data))
+			}
+		})
+	}
+}
+
+func TestQSOLoggedFields(t *testing.T) {
+	q := &QSOLogged{
+		TimeOff: timeOff, DXCall: "K1ABC", DXGrid: "FN42", TxFrequency: 14074000,
+		Mode: "FT8", ReportSent: "-10", ReportReceived: "-12", TxPower: "100",
+		TimeOn: timeOn, MyCall: "BG2ABC", MyGrid: "PN11",
+	}
+	got := q.Fields()
+	want := map[string]string{
+		"call": "K1ABC", "gridsquare": "FN42", "mode": "FT8", "rst_sent": "-10", "rst_rcvd": "-12",
+		"tx_pwr": "100", "comment": "", "name": "", "operator": "", "station_callsign": "BG2ABC",
+		"my_gridsquare": "PN11", "stx_string": "", "srx_string": "", "prop_mode": "",
+		"freq": "14.074", "band": "20m",
+		"qso_date": "20240601", "time_on": "123015",
+		"qso_date_off": "20240601", "time_off": "123145",
+	}
+	if !maps.Equal(got, want) {
+		t.Errorf("Fields() = %v, want %v", got, want)
+	}
+
+	// 没有频率和时间时不写入对应的字段
+	got = (&QSOLogged{DXCall: "K1ABC"}).Fields()
+	for _, name := range []string{"freq", "band", "qso_date", "time_on", "qso_date_off", "time_off"} {
+		if _, ok := got[name]; ok {
+			t.Errorf("Fields() contains %s = %q", name, got[name])
+		}
+	}
+}